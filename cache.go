@@ -0,0 +1,318 @@
+package dago
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/inf.v0"
+)
+
+// Cache of rows read by Get, see DataAccess.WithCache. Values are DAO copies which must not
+// be modified, implementations backed by other processes need to serialize them.
+type Cache interface {
+	// Value stored under the key, if any and not expired
+	Get(key string) (interface{}, bool)
+	// Stores the value, expiring after the TTL unless zero
+	Set(key string, value interface{}, ttl time.Duration)
+	Delete(key string)
+	// Removes all entries whose key starts with the prefix
+	DeletePrefix(prefix string)
+}
+
+// In-process Cache evicting the least recently used entries once full.
+type LRUCache struct {
+	mutex   sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List // most recently used first
+}
+
+type lruEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time // zero when never
+}
+
+// Creates a cache holding at most size entries.
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{size: size, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+func (self *LRUCache) Get(key string) (interface{}, bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	elem, ok := self.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		self.remove(elem)
+		return nil, false
+	}
+	self.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (self *LRUCache) Set(key string, value interface{}, ttl time.Duration) {
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if elem, ok := self.entries[key]; ok {
+		*elem.Value.(*lruEntry) = lruEntry{key, value, expires}
+		self.order.MoveToFront(elem)
+		return
+	}
+	self.entries[key] = self.order.PushFront(&lruEntry{key, value, expires})
+	for self.order.Len() > self.size {
+		self.remove(self.order.Back())
+	}
+}
+
+func (self *LRUCache) Delete(key string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if elem, ok := self.entries[key]; ok {
+		self.remove(elem)
+	}
+}
+
+// Goes over all entries, which is fine for the partition and table deletes calling it.
+func (self *LRUCache) DeletePrefix(prefix string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for key, elem := range self.entries {
+		if strings.HasPrefix(key, prefix) {
+			self.remove(elem)
+		}
+	}
+}
+
+// Number of entries, including expired ones not evicted yet.
+func (self *LRUCache) Len() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.order.Len()
+}
+
+func (self *LRUCache) remove(elem *list.Element) {
+	self.order.Remove(elem)
+	delete(self.entries, elem.Value.(*lruEntry).key)
+}
+
+// Sets how long rows of the DAO type stay in the cache of a DataAccess, the type not being
+// cached when zero. See DataAccess.WithCache.
+func WithCacheTTL(ttl time.Duration) DAOOption {
+	return func(info *DAOInfo) {
+		info.CacheTTL = ttl
+	}
+}
+
+// Returns a copy of the DataAccess reading rows through the cache in Get, for DAO types
+// registered with WithCacheTTL. Rows are cached by table and primary keys, concurrent misses
+// on the same row issuing a single query whatever the context of the callers, and copied to
+// the DAOs passed to Get. Writes of the DataAccess or its copies remove the rows they touch
+// from the cache: the row for saves, Delete and DeleteFields, the partition for
+// DeletePartition, DeleteRange and Rollback, and the whole table for SaveJSON. Writes from
+// elsewhere and in flight reads racing with writes are only caught up with when entries
+// expire. Hooks aren't called on hits.
+// Example:
+//
+//	da.Registry().Register(&Block{}, dago.WithCacheTTL(5*time.Second))
+//	cached := da.WithCache(dago.NewLRUCache(10000))
+//	tip, err := cached.Get(&Block{Hash: tipHash})
+func (self *DataAccess) WithCache(cache Cache) *DataAccess {
+	da := *self
+	da.cache = cache
+	da.flights = &flightGroup{}
+	return &da
+}
+
+// Same as Get, going through the cache.
+func (self *DataAccess) cachedGet(dao DAOLite, ttl time.Duration) (DAOLite, error) {
+	key := self.cacheKey(self.tableOf(dao), self.Keys(dao))
+	v := reflect.ValueOf(dao)
+	if cached, ok := self.cache.Get(key); ok && reflect.TypeOf(cached) == v.Type() {
+		v.Elem().Set(deepCopy(reflect.ValueOf(cached).Elem()))
+		return dao, nil
+	}
+	row, err := self.flights.do(self.ctx, v.Type().String()+"|"+key, func() (DAOLite, error) {
+		fresh := reflect.New(v.Type().Elem())
+		fresh.Elem().Set(v.Elem())
+		// shared by all callers, so not canceled with the first one, which may leave first
+		detached := self.WithContext(context.WithoutCancel(self.ctx))
+		row, err := detached.GetBy(self.Keys(dao), fresh.Interface().(DAOLite))
+		if err == nil {
+			self.cache.Set(key, row, ttl)
+		}
+		return row, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	v.Elem().Set(deepCopy(reflect.ValueOf(row).Elem()))
+	return dao, nil
+}
+
+// Removes the row of the DAO in the table from the cache, if any.
+func (self *DataAccess) uncache(table string, dao DAOLite) {
+	if self.cached(dao) {
+		self.cache.Delete(self.cacheKey(table, self.Keys(dao)))
+	}
+}
+
+// Removes the rows of the table whose primary keys start with the provided ones from the
+// cache, all of them when none.
+func (self *DataAccess) uncacheRange(table string, dao DAOLite, keys []*F) {
+	if self.cached(dao) {
+		self.cache.DeletePrefix(self.cacheKey(table, keys))
+	}
+}
+
+// Whether rows of the DAO type go through the cache.
+func (self *DataAccess) cached(dao DAOLite) bool {
+	if self.cache == nil {
+		return false
+	}
+	info, err := self.registry.Lookup(dao)
+	return err == nil && info.CacheTTL > 0
+}
+
+// Table followed by the keys values, each one terminated so keys of a partition share the
+// key of the partition as prefix.
+func (self *DataAccess) cacheKey(table string, keys []*F) string {
+	var sb strings.Builder
+	sb.WriteString(table)
+	sb.WriteString("|")
+	for _, key := range keys {
+		fmt.Fprintf(&sb, "%#v|", key.Value)
+	}
+	return sb.String()
+}
+
+// Copy of the value sharing no memory with it, so cached rows can't be modified through the
+// DAOs they're copied to. Unexported fields are copied as is, but for the ones of big.Int and
+// inf.Dec values, cloned with their Set methods.
+func deepCopy(v reflect.Value) reflect.Value {
+	switch n := v.Interface().(type) {
+	case *big.Int:
+		if n != nil {
+			return reflect.ValueOf(new(big.Int).Set(n))
+		}
+	case big.Int:
+		return reflect.ValueOf(new(big.Int).Set(&n)).Elem()
+	case *inf.Dec:
+		if n != nil {
+			return reflect.ValueOf(new(inf.Dec).Set(n))
+		}
+	case inf.Dec:
+		return reflect.ValueOf(new(inf.Dec).Set(&n)).Elem()
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(c, v)
+		copyElems(c, v)
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		copyElems(c, v)
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			c.SetMapIndex(iter.Key(), deepCopy(iter.Value()))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for n := 0; n < v.NumField(); n++ {
+			if v.Type().Field(n).IsExported() {
+				c.Field(n).Set(deepCopy(v.Field(n)))
+			}
+		}
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopy(v.Elem()))
+		return c
+	}
+	return v
+}
+
+// Deep copies the elements of the slice or array to the other one, unless they hold no
+// reference, like bytes, already copied then.
+func copyElems(dst, src reflect.Value) {
+	switch src.Type().Elem().Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map, reflect.Struct, reflect.Interface:
+		for n := 0; n < src.Len(); n++ {
+			dst.Index(n).Set(deepCopy(src.Index(n)))
+		}
+	}
+}
+
+// Runs a function once at a time per key, in the background, concurrent callers waiting for
+// and sharing its result unless their context is done first.
+type flightGroup struct {
+	mutex sync.Mutex
+	calls map[string]*flight
+}
+
+type flight struct {
+	done chan struct{} // closed once the result is set
+	row  DAOLite
+	err  error
+}
+
+func (self *flightGroup) do(ctx context.Context, key string, fn func() (DAOLite, error)) (DAOLite, error) {
+	self.mutex.Lock()
+	if self.calls == nil {
+		self.calls = make(map[string]*flight)
+	}
+	call, ok := self.calls[key]
+	if !ok {
+		call = &flight{done: make(chan struct{})}
+		self.calls[key] = call
+		go func() {
+			call.row, call.err = fn()
+			self.mutex.Lock()
+			delete(self.calls, key)
+			self.mutex.Unlock()
+			close(call.done)
+		}()
+	}
+	self.mutex.Unlock()
+	select {
+	case <-call.done:
+		return call.row, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
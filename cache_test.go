@@ -0,0 +1,216 @@
+package dago
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/inf.v0"
+)
+
+func TestLRUCache(t *testing.T) {
+	cache := NewLRUCache(2)
+	cache.Set("a", 1, 0)
+	cache.Set("b", 2, 0)
+	_, ok := cache.Get("a")
+	assert.True(t, ok)
+	cache.Set("c", 3, 0)
+	// b was the least recently used
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+	v, ok := cache.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 3, v)
+	assert.Equal(t, 2, cache.Len())
+
+	cache.Set("a", 4, time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	_, ok = cache.Get("a")
+	assert.False(t, ok)
+	cache.Delete("c")
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestFlightGroup(t *testing.T) {
+	group := &flightGroup{}
+	var calls int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	rows := make([]DAOLite, 10)
+	for n := range rows {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			rows[n], _ = group.do(context.Background(), "k", func() (DAOLite, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return &CachedBlock{Hash: "00ab"}, nil
+			})
+		}(n)
+	}
+	// let all goroutines wait on the first call
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	for _, row := range rows {
+		assert.Same(t, rows[0], row)
+	}
+
+	// canceled callers don't wait
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	release = make(chan struct{})
+	defer close(release)
+	_, err := group.do(ctx, "k", func() (DAOLite, error) {
+		<-release
+		return nil, nil
+	})
+	assert.Equal(t, context.Canceled, err)
+}
+
+type CachedBlock struct {
+	Hash   string   `column:"hash,key"`
+	Height int64    `column:"height"`
+	Txs    []string `column:"txs"`
+	Fees   *inf.Dec `column:"fees"`
+	Reward big.Int  `column:"reward"`
+}
+
+func (self *CachedBlock) TableName() string {
+	return "blocks"
+}
+
+func TestCachedGet(t *testing.T) {
+	da := NewDataAccess(NewCQLHelper(nil)).In("bitcoin")
+	_, err := da.Registry().Register(&CachedBlock{}, WithCacheTTL(time.Minute))
+	assert.NoError(t, err)
+	cache := NewLRUCache(10)
+	cached := da.WithCache(cache)
+
+	key := cached.cacheKey("bitcoin.blocks", cached.Keys(&CachedBlock{Hash: "00ab"}))
+	assert.Equal(t, `bitcoin.blocks|"00ab"|`, key)
+	cache.Set(key, &CachedBlock{"00ab", 481824, []string{"4a5e"}, inf.NewDec(5, 1), *big.NewInt(625)}, time.Minute)
+
+	// served from the cache, the helper having no session
+	block := &CachedBlock{Hash: "00ab"}
+	_, err = cached.Get(block)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(481824), block.Height)
+	// the cached row isn't shared
+	block.Txs[0] = "ffff"
+	block.Fees.SetUnscaled(7)
+	block.Reward.Add(&block.Reward, big.NewInt(1))
+	_, err = cached.Get(block)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"4a5e"}, block.Txs)
+	assert.Equal(t, "0.5", block.Fees.String())
+	assert.Equal(t, "625", block.Reward.String())
+
+	cached.MapTables(map[string]string{}).uncache("bitcoin.blocks", block)
+	_, ok := cache.Get(key)
+	assert.False(t, ok)
+}
+
+type CachedOutput struct {
+	Address string `column:"address,key"`
+	Height  int64  `column:"height,sort"`
+	Value   int64  `column:"value"`
+}
+
+func (self *CachedOutput) TableName() string {
+	return "outputs"
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	_, da := newRecorder(func(st *Statement) ([][]interface{}, error) {
+		if st.Op == OpSelect {
+			return [][]interface{}{{int64(5), int64(200)}}, nil
+		}
+		return nil, nil
+	})
+	_, err := da.Registry().Register(&CachedBlock{}, WithKeyspace("bitcoin"), WithCacheTTL(time.Minute))
+	assert.NoError(t, err)
+	_, err = da.Registry().Register(&CachedOutput{}, WithHeight("Height", ""), WithCacheTTL(time.Minute))
+	assert.NoError(t, err)
+	cache := NewLRUCache(10)
+	cached := da.WithCache(cache)
+	// caches the rows, returning whether the DAOs still are afterwards
+	seed := func(daos ...DAOLite) func() []bool {
+		for _, dao := range daos {
+			cache.Set(cached.cacheKey(cached.tableOf(dao), cached.Keys(dao)), dao, time.Minute)
+		}
+		return func() []bool {
+			found := make([]bool, len(daos))
+			for n, dao := range daos {
+				_, found[n] = cache.Get(cached.cacheKey(cached.tableOf(dao), cached.Keys(dao)))
+			}
+			return found
+		}
+	}
+	a, b := &CachedBlock{Hash: "00ab"}, &CachedBlock{Hash: "00cd"}
+
+	left := seed(a, b)
+	assert.NoError(t, cached.Save(a))
+	assert.Equal(t, []bool{false, true}, left())
+
+	// keyed on the table of the DAO, not the provided one
+	left = seed(a, b)
+	assert.NoError(t, cached.SaveTable("blocks", a))
+	assert.Equal(t, []bool{false, true}, left())
+
+	left = seed(a, b)
+	assert.NoError(t, cached.DeleteFields(a, "Height"))
+	assert.Equal(t, []bool{false, true}, left())
+
+	left = seed(a, b)
+	assert.NoError(t, cached.DeletePartition(a))
+	assert.Equal(t, []bool{false, true}, left())
+
+	left = seed(a, b)
+	assert.NoError(t, cached.SaveJSON(a, json.RawMessage(`{"hash": "00ab", "height": 1}`)))
+	assert.Equal(t, []bool{false, false}, left())
+
+	a1, a2, b1 := &CachedOutput{"a", 1, 0}, &CachedOutput{"a", 2, 0}, &CachedOutput{"b", 1, 0}
+	left = seed(a1, a2, b1)
+	assert.NoError(t, cached.DeleteRange(&CachedOutput{Address: "a"}, Gt("Height", 1)))
+	assert.Equal(t, []bool{false, false, true}, left())
+
+	left = seed(a1, a2, b1)
+	_, err = cached.Rollback(100, []DAOLite{&CachedOutput{Address: "b"}}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, true, false}, left())
+}
+
+func TestCachedGetDetached(t *testing.T) {
+	helper := NewCQLHelper(&gocql.Session{})
+	var canceled error
+	helper.Use(func(ctx context.Context, st *Statement, next Invoker) Iter {
+		canceled = ctx.Err()
+		return &fakeIter{rows: [][]interface{}{{int64(481824), nil, nil, nil}}}
+	})
+	da := NewDataAccess(helper)
+	_, err := da.Registry().Register(&CachedBlock{}, WithCacheTTL(time.Minute))
+	assert.NoError(t, err)
+	cached := da.WithCache(NewLRUCache(10))
+
+	// the query goes on for other callers when the first one gives up
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = cached.WithContext(ctx).Get(&CachedBlock{Hash: "00ab"})
+	assert.Equal(t, context.Canceled, err)
+	assert.Eventually(t, func() bool {
+		_, ok := cached.cache.Get(cached.cacheKey("blocks", cached.Keys(&CachedBlock{Hash: "00ab"})))
+		return ok
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, canceled)
+	block, err := cached.Get(&CachedBlock{Hash: "00ab"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(481824), block.(*CachedBlock).Height)
+}
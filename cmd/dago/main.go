@@ -0,0 +1,175 @@
+// Command dago exports tables to files and imports them back, in CSV, JSON Lines or Parquet,
+// reading the tables definition from system_schema so no DAO is needed.
+//
+//	dago export -hosts 10.0.0.1 -keyspace bitcoin -table txs -output txs.parquet
+//	dago import -hosts 10.0.0.2 -keyspace bitcoin -table txs -input txs.parquet -progress txs.progress
+//
+// The format follows the file extension unless set with -format. Imports record the number
+// of rows imported in the -progress file after each batch, and resume from there when run
+// again with the same file.
+//
+// Only the table definition read from the cluster is used, the command knowing nothing of
+// DAOs. Each row is written with its own INSERT JSON statement, -concurrency of them at a
+// time, -batch only setting how often progress is recorded.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/blockcypher/dago"
+	"github.com/blockcypher/dago/transfer"
+	"github.com/gocql/gocql"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = export(os.Args[2:])
+	case "import":
+		err = imprt(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "dago:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dago export|import [flags], see dago export -h")
+	os.Exit(2)
+}
+
+type tableFlags struct {
+	hosts, keyspace, table, format *string
+}
+
+func addTableFlags(fs *flag.FlagSet) *tableFlags {
+	return &tableFlags{
+		fs.String("hosts", "127.0.0.1", "comma separated list of hosts"),
+		fs.String("keyspace", "", "keyspace of the table"),
+		fs.String("table", "", "table to export or import"),
+		fs.String("format", "", "csv, jsonl or parquet, from the file extension when empty"),
+	}
+}
+
+// Session and definition of the table.
+func (self *tableFlags) open(path string) (*gocql.Session, *dago.TableSchema, transfer.Format, error) {
+	if *self.keyspace == "" || *self.table == "" {
+		return nil, nil, "", errors.New("-keyspace and -table are required")
+	}
+	format := transfer.Format(*self.format)
+	if format == "" {
+		if format = transfer.FormatOf(path); format == "" {
+			return nil, nil, "", errors.New("unknown format, set -format")
+		}
+	}
+	cluster := gocql.NewCluster(strings.Split(*self.hosts, ",")...)
+	cluster.Keyspace = *self.keyspace
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	tables, err := dago.ReadKeyspaceSchema(session, *self.keyspace)
+	if err != nil {
+		session.Close()
+		return nil, nil, "", err
+	}
+	for _, table := range tables {
+		if table.Name == *self.table {
+			return session, table, format, nil
+		}
+	}
+	session.Close()
+	return nil, nil, "", fmt.Errorf("no table %s in keyspace %s", *self.table, *self.keyspace)
+}
+
+func export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	tf := addTableFlags(fs)
+	output := fs.String("output", "", "file to write to, standard output when empty")
+	fs.Parse(args)
+
+	session, table, format, err := tf.open(*output)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	cols := make([]string, len(table.Columns))
+	for n, col := range table.Columns {
+		cols[n] = dago.QuoteIdent(col.Name)
+	}
+	iter := dago.NewCQLHelper(session).FullScanJSON(table.Name, cols...)
+	n, err := transfer.Export(iter, table, format, w)
+	fmt.Fprintf(os.Stderr, "exported %d rows\n", n)
+	return err
+}
+
+func imprt(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	tf := addTableFlags(fs)
+	input := fs.String("input", "", "file to read from")
+	concurrency := fs.Int("concurrency", 16, "rows written concurrently")
+	batch := fs.Int("batch", 1000, "rows written between progress records")
+	progress := fs.String("progress", "", "file recording the rows imported, to resume interrupted imports")
+	fs.Parse(args)
+
+	if *input == "" {
+		return errors.New("-input is required")
+	}
+	session, table, format, err := tf.open(*input)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	f, err := os.Open(*input)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	opts := transfer.ImportOptions{Concurrency: *concurrency, BatchSize: *batch}
+	if *progress != "" {
+		if done, err := os.ReadFile(*progress); err == nil {
+			if opts.Skip, err = strconv.Atoi(strings.TrimSpace(string(done))); err != nil {
+				return fmt.Errorf("bad progress file %s: %v", *progress, err)
+			}
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		opts.Progress = func(done int) error {
+			return os.WriteFile(*progress, []byte(strconv.Itoa(done)+"\n"), 0644)
+		}
+	}
+	helper := dago.NewCQLHelper(session)
+	save := func(doc []byte) error {
+		return helper.SaveJSON(table.Name, doc)
+	}
+	n, err := transfer.Import(save, table, format, f, opts)
+	// files shorter than the progress recorded end while skipping
+	skipped := min(n, opts.Skip)
+	fmt.Fprintf(os.Stderr, "imported %d rows, %d skipped\n", n-skipped, skipped)
+	return err
+}
@@ -0,0 +1,61 @@
+// Code generated by dagogen. DO NOT EDIT.
+
+package users
+
+import "github.com/blockcypher/dago"
+
+type dagoMapperUser struct{}
+
+func (dagoMapperUser) Columns() []string {
+	return []string{"country", "ssn", "age", "height", "id", "joined", "timeout", "editor"}
+}
+
+func (dagoMapperUser) Value(dao interface{}, field string) interface{} {
+	d := dao.(*User)
+	switch field {
+	case "Country":
+		return string(d.Country)
+	case "SSN":
+		return d.SSN
+	case "Age":
+		return int64(d.Age)
+	case "Height":
+		return uint32(d.Height)
+	case "ID":
+		return d.ID
+	case "Joined":
+		return d.Joined
+	case "Timeout":
+		return d.Timeout
+	case "Editor":
+		return d.Audit.Editor
+	}
+	return nil
+}
+
+func (dagoMapperUser) Dest(dao interface{}, field string) interface{} {
+	d := dao.(*User)
+	switch field {
+	case "Country":
+		return &d.Country
+	case "SSN":
+		return &d.SSN
+	case "Age":
+		return &d.Age
+	case "Height":
+		return &d.Height
+	case "ID":
+		return &d.ID
+	case "Joined":
+		return &d.Joined
+	case "Timeout":
+		return &d.Timeout
+	case "Editor":
+		return &d.Audit.Editor
+	}
+	return nil
+}
+
+func init() {
+	dago.RegisterMapper(&User{}, dagoMapperUser{})
+}
@@ -0,0 +1,35 @@
+// Package users holds DAOs of all kinds of field types, whose mappers are generated by
+// dagogen, to check they compile and bind values like DataAccess does.
+package users
+
+//go:generate go run github.com/blockcypher/dago/cmd/dagogen
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+type Height uint32
+
+type Country string
+
+type User struct {
+	Country Country       `column:"country,key"`
+	SSN     string        `column:"ssn,sort,redact"`
+	Age     int           `column:"age"`
+	Height  Height        `column:"height"`
+	ID      gocql.UUID    `column:"id"`
+	Joined  time.Time     `column:"joined"`
+	Timeout time.Duration `column:"timeout"`
+	*Audit  `column:",traverse"`
+	note    string
+}
+
+func (self *User) TableName() string {
+	return "users"
+}
+
+type Audit struct {
+	Editor string `column:"editor"`
+}
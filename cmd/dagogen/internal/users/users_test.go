@@ -0,0 +1,45 @@
+package users
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/blockcypher/dago"
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+// Native types of the CQL types of the fixture columns
+var cqlTypes = map[string]gocql.Type{
+	"text":      gocql.TypeText,
+	"bigint":    gocql.TypeBigInt,
+	"uuid":      gocql.TypeUUID,
+	"timestamp": gocql.TypeTimestamp,
+	"time":      gocql.TypeTime,
+}
+
+func TestGeneratedMapper(t *testing.T) {
+	da := dago.NewDataAccess(dago.NewCQLHelper(nil))
+	user := &User{"US", "890-123-4567", 42, 481824, gocql.TimeUUID(), time.UnixMilli(1500000000000).UTC(),
+		time.Minute, &Audit{"joe"}, ""}
+	info, err := da.Registry().Lookup(user)
+	assert.NoError(t, err)
+	// not stale, so used by DataAccess
+	assert.Equal(t, info.KeyColumns(), dagoMapperUser{}.Columns()[:2])
+	assert.Len(t, dagoMapperUser{}.Columns(), len(info.Columns))
+
+	// values bound like with reflection, then scanned back through gocql
+	schema := info.Schema(user)
+	scanned := &User{Audit: &Audit{}}
+	v := reflect.ValueOf(user).Elem()
+	for _, col := range info.Columns {
+		value := dagoMapperUser{}.Value(user, col.Field)
+		assert.Equal(t, dago.BindValue(v.FieldByName(col.Field).Interface()), value, col.Field)
+		typ := gocql.NewNativeType(4, cqlTypes[schema.Column(col.Column).Type], "")
+		data, err := gocql.Marshal(typ, value)
+		assert.NoError(t, err, col.Field)
+		assert.NoError(t, gocql.Unmarshal(typ, data, dagoMapperUser{}.Dest(scanned, col.Field)), col.Field)
+	}
+	assert.Equal(t, user, scanned)
+}
@@ -0,0 +1,355 @@
+// Command dagogen generates reflection free mappers for the DAO types of a package, which
+// DataAccess then uses automatically. Add the following to a file of the package holding
+// the DAOs and run go generate:
+//
+//	//go:generate go run github.com/blockcypher/dago/cmd/dagogen
+//
+// All struct types with a TableName method are handled unless -type restricts them. The
+// mappers are written to dago_mappers.go by default and must be regenerated whenever the
+// DAOs change. Stale mappers are detected and ignored at runtime, reflection being used
+// instead. Field types are type checked from source to bind values without reflection,
+// dago.BindValue being left for the ones which can't be.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blockcypher/dago"
+)
+
+const dagoImport = "github.com/blockcypher/dago"
+
+func main() {
+	output := flag.String("output", "dago_mappers.go", "name of the generated file")
+	types := flag.String("type", "", "comma separated list of the DAO types to generate mappers for, all when empty")
+	flag.Parse()
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	var only []string
+	if *types != "" {
+		only = strings.Split(*types, ",")
+	}
+
+	src, err := generate(dir, *output, only)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "dagogen:", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(filepath.Join(dir, *output), src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "dagogen:", err)
+		os.Exit(1)
+	}
+}
+
+// A persisted field of a DAO, mirroring the field definitions computed by DataAccess
+type field struct {
+	name string // field name as known by DataAccess
+	path string // selector from the DAO to the field
+	col  string
+	typ  types.Type // nil or invalid when it couldn't be type checked
+}
+
+type pkgInfo struct {
+	name    string
+	structs map[string]*ast.StructType
+	daos    map[string]bool // types with a TableName method
+	types   *types.Info
+}
+
+// Generates the mappers source for all DAOs of the package in dir.
+func generate(dir, output string, only []string) ([]byte, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	pkg := &pkgInfo{structs: make(map[string]*ast.StructType), daos: make(map[string]bool),
+		types: &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)}}
+	parsed := make([]*ast.File, 0, len(files))
+	for _, file := range files {
+		base := filepath.Base(file)
+		if strings.HasSuffix(base, "_test.go") || base == output {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		pkg.add(f)
+		parsed = append(parsed, f)
+	}
+	// field types tell how to bind values without reflection, errors only leaving some of
+	// them unknown
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil), Error: func(error) {}}
+	conf.Check(pkg.name, fset, parsed, pkg.types)
+	return pkg.generate(only)
+}
+
+func (self *pkgInfo) add(f *ast.File) {
+	self.name = f.Name.Name
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok {
+					if st, ok := ts.Type.(*ast.StructType); ok {
+						self.structs[ts.Name.Name] = st
+					}
+				}
+			}
+		case *ast.FuncDecl:
+			if decl.Recv != nil && decl.Name.Name == "TableName" && len(decl.Recv.List) == 1 {
+				if name := typeName(decl.Recv.List[0].Type); name != "" {
+					self.daos[name] = true
+				}
+			}
+		}
+	}
+}
+
+func (self *pkgInfo) generate(only []string) ([]byte, error) {
+	names := make([]string, 0, len(self.daos))
+	for name := range self.daos {
+		if _, ok := self.structs[name]; ok && (len(only) == 0 || contains(only, name)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no DAO type found in package %s", self.name)
+	}
+
+	qual := "dago."
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "// Code generated by dagogen. DO NOT EDIT.\n\npackage %s\n\n", self.name)
+	if self.name == "dago" {
+		qual = ""
+	} else {
+		fmt.Fprintf(buf, "import %q\n\n", dagoImport)
+	}
+
+	for _, name := range names {
+		fields, err := self.fields(self.structs[name], "d.")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		writeMapper(buf, qual, name, fields)
+	}
+
+	fmt.Fprintf(buf, "func init() {\n")
+	for _, name := range names {
+		fmt.Fprintf(buf, "\t%sRegisterMapper(&%s{}, %s{})\n", qual, name, mapperName(name))
+	}
+	fmt.Fprintf(buf, "}\n")
+	return format.Source(buf.Bytes())
+}
+
+// Persisted fields of the struct, following the same rules as DataAccess.
+func (self *pkgInfo) fields(st *ast.StructType, prefix string) ([]*field, error) {
+	fields := make([]*field, 0, len(st.Fields.List))
+	for _, f := range st.Fields.List {
+		tag, tagged := "", false
+		if f.Tag != nil {
+			unquoted, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag, tagged = reflect.StructTag(unquoted).Lookup("column")
+		}
+		anonymous := len(f.Names) == 0
+		if !tagged {
+			if !anonymous && exported(f.Names) {
+				return nil, fmt.Errorf("field %s has no column tag", f.Names[0].Name)
+			}
+			continue
+		}
+		colspec := strings.Split(tag, ",")
+		traverse, skip := false, false
+		for _, qualifier := range colspec[1:] {
+			switch {
+			case !contains(dago.TagQualifiers(), qualifier):
+				if !anonymous {
+					return nil, fmt.Errorf("bad column tag qualifier: %s", qualifier)
+				}
+				skip = true
+			case qualifier == "traverse":
+				traverse = true
+			}
+		}
+		if skip {
+			continue
+		}
+
+		names := []string{typeName(f.Type)}
+		if !anonymous {
+			names = names[:0]
+			for _, ident := range f.Names {
+				// unexported fields are ignored
+				if ident.IsExported() {
+					names = append(names, ident.Name)
+				}
+			}
+		}
+		for _, name := range names {
+			if traverse {
+				var inner *ast.StructType
+				if star, ok := f.Type.(*ast.StarExpr); ok {
+					if ident, ok := star.X.(*ast.Ident); ok {
+						inner = self.structs[ident.Name]
+					}
+				}
+				if inner == nil || !anonymous {
+					return nil, fmt.Errorf("traversed field %s must be an embedded pointer to a struct of the package", name)
+				}
+				innerFields, err := self.fields(inner, prefix+name+".")
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, innerFields...)
+				continue
+			}
+			fields = append(fields, &field{name, prefix + name, colspec[0], self.types.TypeOf(f.Type)})
+		}
+	}
+	return fields, nil
+}
+
+func writeMapper(buf *bytes.Buffer, qual, name string, fields []*field) {
+	mapper := mapperName(name)
+	fmt.Fprintf(buf, "type %s struct{}\n\n", mapper)
+
+	cols := make([]string, len(fields))
+	for n, f := range fields {
+		cols[n] = strconv.Quote(f.col)
+	}
+	fmt.Fprintf(buf, "func (%s) Columns() []string {\n\treturn []string{%s}\n}\n\n", mapper, strings.Join(cols, ", "))
+
+	seen := make(map[string]bool)
+	fmt.Fprintf(buf, "func (%s) Value(dao interface{}, field string) interface{} {\n", mapper)
+	fmt.Fprintf(buf, "\td := dao.(*%s)\n\tswitch field {\n", name)
+	for _, f := range fields {
+		if !seen[f.name] {
+			seen[f.name] = true
+			fmt.Fprintf(buf, "\tcase %q:\n\t\treturn %s\n", f.name, valueExpr(qual, f))
+		}
+	}
+	fmt.Fprintf(buf, "\t}\n\treturn nil\n}\n\n")
+
+	seen = make(map[string]bool)
+	fmt.Fprintf(buf, "func (%s) Dest(dao interface{}, field string) interface{} {\n", mapper)
+	fmt.Fprintf(buf, "\td := dao.(*%s)\n\tswitch field {\n", name)
+	for _, f := range fields {
+		if !seen[f.name] {
+			seen[f.name] = true
+			fmt.Fprintf(buf, "\tcase %q:\n\t\treturn &%s\n", f.name, f.path)
+		}
+	}
+	fmt.Fprintf(buf, "\t}\n\treturn nil\n}\n\n")
+}
+
+// Expression converting the field value the same way DataAccess does with reflection, see
+// dago.BindValue, which is only called when the field type is unknown.
+func valueExpr(qual string, f *field) string {
+	if f.typ == nil || f.typ == types.Typ[types.Invalid] {
+		return qual + "BindValue(" + f.path + ")"
+	}
+	if named, ok := f.typ.(*types.Named); ok && named.Obj().Pkg() != nil &&
+		named.Obj().Pkg().Path() == "time" && named.Obj().Name() == "Duration" {
+		return f.path
+	}
+	// marshalers, through a pointer or not, are bound as is
+	if method, _, _ := types.LookupFieldOrMethod(f.typ, true, nil, "MarshalCQL"); method != nil {
+		return f.path
+	}
+	basic, ok := f.typ.Underlying().(*types.Basic)
+	if !ok {
+		// structs, pointers, slices, arrays and maps are bound as is
+		return f.path
+	}
+	conv := ""
+	switch basic.Kind() {
+	case types.Int, types.Int64:
+		conv = "int64"
+	case types.Int32:
+		conv = "int32"
+	case types.Int16:
+		conv = "int16"
+	case types.Int8:
+		conv = "int8"
+	case types.Uint, types.Uint64:
+		conv = "uint64"
+	case types.Uint32:
+		conv = "uint32"
+	case types.Uint16:
+		conv = "uint16"
+	case types.Uint8:
+		conv = "uint8"
+	case types.Float32:
+		conv = "float32"
+	case types.Float64:
+		conv = "float64"
+	case types.Bool:
+		conv = "bool"
+	case types.String:
+		conv = "string"
+	default:
+		return f.path
+	}
+	if types.Identical(f.typ, types.Universe.Lookup(conv).Type()) {
+		return f.path
+	}
+	return conv + "(" + f.path + ")"
+}
+
+func mapperName(name string) string {
+	return "dagoMapper" + name
+}
+
+// Name of the type, or of the pointed type, when declared in the package.
+func typeName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return expr.Name
+	case *ast.StarExpr:
+		return typeName(expr.X)
+	case *ast.SelectorExpr:
+		return expr.Sel.Name
+	}
+	return ""
+}
+
+// Tells whether one of the field names is exported, the other ones being ignored.
+func exported(names []*ast.Ident) bool {
+	for _, ident := range names {
+		if ident.IsExported() {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The mappers of the fixture package are compiled and checked by its own tests.
+func TestGenerate(t *testing.T) {
+	dir := filepath.Join("internal", "users")
+	src, err := generate(dir, "dago_mappers.go", nil)
+	assert.NoError(t, err)
+	golden, err := os.ReadFile(filepath.Join(dir, "dago_mappers.go"))
+	assert.NoError(t, err)
+	assert.Equal(t, string(golden), string(src), "stale fixture mappers, run go generate ./...")
+
+	_, err = generate(dir, "dago_mappers.go", []string{"Missing"})
+	assert.Error(t, err)
+}
+
+// Level isn't declared
+const daoSrc = `package users
+
+type User struct {
+	Country string ` + "`column:\"country,key\"`" + `
+	Level   Level  ` + "`column:\"level\"`" + `
+}
+
+func (self *User) TableName() string {
+	return "users"
+}
+
+type NotADao struct {
+	Foo string ` + "`column:\"foo\"`" + `
+}
+`
+
+func TestGenerateUnknownTypes(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "users.go"), []byte(daoSrc), 0644))
+	src, err := generate(dir, "dago_mappers.go", nil)
+	assert.NoError(t, err)
+	out := string(src)
+	// types which can't be checked fall back to reflection
+	assert.Contains(t, out, "return dago.BindValue(d.Level)")
+	assert.Contains(t, out, "return d.Country")
+	assert.NotContains(t, out, "NotADao")
+}
+
+func TestGenerateErrors(t *testing.T) {
+	for src, msg := range map[string]string{
+		"Country string `column:\"country,primary\"`": "User: bad column tag qualifier: primary",
+		"Country string": "User: field Country has no column tag",
+	} {
+		dir := t.TempDir()
+		dao := "package users\n\ntype User struct {\n\t" + src + "\n}\n\nfunc (self *User) TableName() string { return \"users\" }\n"
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "users.go"), []byte(dao), 0644))
+		_, err := generate(dir, "dago_mappers.go", nil)
+		assert.EqualError(t, err, msg)
+	}
+}
@@ -0,0 +1,188 @@
+// Command dagostruct writes DAO structs for existing tables, either reading their definition
+// from the system_schema of a keyspace or from a CQL schema file, like the output of
+// DESCRIBE KEYSPACE, so it also works offline.
+//
+//	dagostruct -hosts 10.0.0.1,10.0.0.2 -keyspace bitcoin -package daos -output daos.go
+//	dagostruct -schema bitcoin.cql -tables txs,outputs -package daos
+//
+// The structs are a starting point, meant to be edited.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blockcypher/dago"
+	"github.com/gocql/gocql"
+)
+
+func main() {
+	schema := flag.String("schema", "", "CQL file to read the tables definition from")
+	hosts := flag.String("hosts", "127.0.0.1", "comma separated list of hosts to read system_schema from")
+	keyspace := flag.String("keyspace", "", "keyspace of the tables")
+	tables := flag.String("tables", "", "comma separated list of tables, all when empty")
+	pkg := flag.String("package", "daos", "package name of the generated file")
+	output := flag.String("output", "", "file to write to, standard output when empty")
+	flag.Parse()
+
+	defs, err := readTables(*schema, *hosts, *keyspace)
+	if err != nil {
+		fail(err)
+	}
+	if *tables != "" {
+		defs = filterTables(defs, strings.Split(*tables, ","))
+	}
+	src, err := writeStructs(*pkg, defs)
+	if err != nil {
+		fail(err)
+	}
+	if *output == "" {
+		os.Stdout.Write(src)
+	} else if err := os.WriteFile(*output, src, 0644); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "dagostruct:", err)
+	os.Exit(1)
+}
+
+func readTables(schema, hosts, keyspace string) ([]*dago.TableSchema, error) {
+	if schema != "" {
+		src, err := os.ReadFile(schema)
+		if err != nil {
+			return nil, err
+		}
+		tables, err := dago.ParseCQLSchema(string(src))
+		if err != nil || keyspace == "" {
+			return tables, err
+		}
+		inKeyspace := make([]*dago.TableSchema, 0, len(tables))
+		for _, table := range tables {
+			if table.Keyspace == "" || table.Keyspace == keyspace {
+				inKeyspace = append(inKeyspace, table)
+			}
+		}
+		return inKeyspace, nil
+	}
+
+	if keyspace == "" {
+		return nil, fmt.Errorf("either -schema or -keyspace is required")
+	}
+	session, err := gocql.NewCluster(strings.Split(hosts, ",")...).CreateSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	return dago.ReadKeyspaceSchema(session, keyspace)
+}
+
+func filterTables(tables []*dago.TableSchema, names []string) []*dago.TableSchema {
+	filtered := make([]*dago.TableSchema, 0, len(names))
+	for _, table := range tables {
+		for _, name := range names {
+			if table.Name == name {
+				filtered = append(filtered, table)
+			}
+		}
+	}
+	return filtered
+}
+
+// Go source with a DAO struct for each table.
+func writeStructs(pkg string, tables []*dago.TableSchema) ([]byte, error) {
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("no table found")
+	}
+	imports := make(map[string]bool)
+	body := new(bytes.Buffer)
+	for _, table := range tables {
+		name := goName(table.Name)
+		fmt.Fprintf(body, "type %s struct {\n", name)
+		for _, col := range table.Columns {
+			typ, pkgs := dago.GoTypeOf(col.Type)
+			for _, p := range pkgs {
+				imports[p] = true
+			}
+			tag := col.Name
+			switch col.Kind {
+			case dago.PARTITION_KEY:
+				tag += ",key"
+			case dago.CLUSTERING_KEY:
+				tag += ",sort"
+			}
+			if idx := table.Index(col.Name); idx != nil {
+				switch idx.Class {
+				case dago.IndexNative:
+					tag += ",index"
+				case dago.IndexSAI:
+					tag += ",index=sai"
+				case dago.IndexSASI:
+					tag += ",index=sasi"
+				}
+			}
+			fmt.Fprintf(body, "\t%s %s `column:%s`\n", goName(col.Name), typ, strconv.Quote(tag))
+		}
+		fmt.Fprintf(body, "}\n\n")
+		fmt.Fprintf(body, "func (self *%s) TableName() string {\n\treturn %q\n}\n\n", name, table.Name)
+		if table.Base != "" {
+			fmt.Fprintf(body, "func (self *%s) BaseTable() string {\n\treturn %q\n}\n\n", name, table.Base)
+		}
+	}
+
+	src := new(bytes.Buffer)
+	fmt.Fprintf(src, "// Generated by dagostruct.\n\npackage %s\n\n", pkg)
+	if len(imports) > 0 {
+		pkgs := make([]string, 0, len(imports))
+		for p := range imports {
+			pkgs = append(pkgs, p)
+		}
+		// standard packages first, like goimports groups them
+		sort.Slice(pkgs, func(i, j int) bool {
+			if std(pkgs[i]) != std(pkgs[j]) {
+				return std(pkgs[i])
+			}
+			return pkgs[i] < pkgs[j]
+		})
+		fmt.Fprintf(src, "import (\n")
+		for n, p := range pkgs {
+			if n > 0 && std(p) != std(pkgs[n-1]) {
+				fmt.Fprintf(src, "\n")
+			}
+			fmt.Fprintf(src, "\t%q\n", p)
+		}
+		fmt.Fprintf(src, ")\n\n")
+	}
+	src.Write(body.Bytes())
+	return format.Source(src.Bytes())
+}
+
+// Tells whether the import path is the one of a standard package, without a domain.
+func std(path string) bool {
+	return !strings.Contains(strings.SplitN(path, "/", 2)[0], ".")
+}
+
+var initialisms = map[string]bool{"id": true, "uuid": true, "url": true, "ip": true, "json": true, "api": true, "ssn": true}
+
+// Exported Go name for a snake case CQL name, like tx_id to TxID.
+func goName(name string) string {
+	var sb strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' || r == ' ' }) {
+		if initialisms[strings.ToLower(part)] {
+			sb.WriteString(strings.ToUpper(part))
+		} else {
+			sb.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	if sb.Len() == 0 || sb.String()[0] >= '0' && sb.String()[0] <= '9' {
+		return "X" + sb.String()
+	}
+	return sb.String()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blockcypher/dago"
+	"github.com/stretchr/testify/assert"
+)
+
+// The schema has frozen collections, user defined types, case sensitive columns and a view.
+func TestWriteStructs(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join("testdata", "schema.cql"))
+	assert.NoError(t, err)
+	tables, err := dago.ParseCQLSchema(string(src))
+	assert.NoError(t, err)
+	out, err := writeStructs("daos", tables)
+	assert.NoError(t, err)
+	golden, err := os.ReadFile(filepath.Join("testdata", "daos.go.golden"))
+	assert.NoError(t, err)
+	assert.Equal(t, string(golden), string(out))
+
+	_, err = writeStructs("daos", nil)
+	assert.EqualError(t, err, "no table found")
+}
+
+func TestGoName(t *testing.T) {
+	for name, goname := range map[string]string{
+		"tx_hash":     "TxHash",
+		"user_id":     "UserID",
+		"signedUp":    "SignedUp",
+		"Value":       "Value",
+		"json_api":    "JSONAPI",
+		"2fa_enabled": "X2faEnabled",
+		"_":           "X",
+	} {
+		assert.Equal(t, goname, goName(name), name)
+	}
+}
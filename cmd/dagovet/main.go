@@ -0,0 +1,14 @@
+// Command dagovet checks DAO definitions with the tagcheck analyzer, as a go vet tool:
+//
+//	go install github.com/blockcypher/dago/cmd/dagovet
+//	go vet -vettool=$(which dagovet) ./...
+package main
+
+import (
+	"github.com/blockcypher/dago/tagcheck"
+	"golang.org/x/tools/go/analysis/unitchecker"
+)
+
+func main() {
+	unitchecker.Main(tagcheck.Analyzer)
+}
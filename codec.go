@@ -0,0 +1,132 @@
+package dago
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/gocql/gocql"
+)
+
+// Converts field values of a Go type gocql can't marshal, or not the way wanted, to and
+// from values it stores in columns of a CQL type. See NewCodec.
+type Codec interface {
+	GoType() reflect.Type
+	// Type of the values stored, scanned from and bound to statements
+	StoredType() reflect.Type
+	// CQL type of the columns, for schema generation
+	CQLType() string
+	Encode(v interface{}) (interface{}, error)
+	// Not called for NULL or empty stored values, fields being set to their zero value
+	Decode(stored interface{}) (interface{}, error)
+}
+
+type funcCodec[T, S any] struct {
+	cqlType string
+	encode  func(T) (S, error)
+	decode  func(S) (T, error)
+}
+
+// Codec storing values of type T as values of type S in columns of the CQL type.
+// Example:
+//
+//	type Hash [32]byte
+//
+//	da.RegisterCodec(dago.NewCodec("blob",
+//		func(h Hash) ([]byte, error) { return h[:], nil },
+//		func(b []byte) (h Hash, err error) {
+//			if len(b) != len(h) {
+//				return h, errors.New("bad hash length")
+//			}
+//			copy(h[:], b)
+//			return h, nil
+//		}))
+func NewCodec[T, S any](cqlType string, encode func(T) (S, error), decode func(S) (T, error)) Codec {
+	return &funcCodec[T, S]{cqlType, encode, decode}
+}
+
+func (self *funcCodec[T, S]) GoType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+func (self *funcCodec[T, S]) StoredType() reflect.Type {
+	return reflect.TypeOf((*S)(nil)).Elem()
+}
+
+func (self *funcCodec[T, S]) CQLType() string {
+	return self.cqlType
+}
+
+func (self *funcCodec[T, S]) Encode(v interface{}) (interface{}, error) {
+	return self.encode(v.(T))
+}
+
+func (self *funcCodec[T, S]) Decode(stored interface{}) (interface{}, error) {
+	return self.decode(stored.(S))
+}
+
+// Registers a codec for all DAOs fields of its Go type, replacing any previous one. Fields
+// with a codec bypass generated mappers.
+func (self *Registry) RegisterCodec(codec Codec) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.codecs == nil {
+		self.codecs = make(map[reflect.Type]Codec)
+	}
+	self.codecs[codec.GoType()] = codec
+}
+
+func (self *Registry) codec(t reflect.Type) Codec {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	return self.codecs[t]
+}
+
+// See Registry.RegisterCodec.
+func (self *DataAccess) RegisterCodec(codec Codec) {
+	self.registry.RegisterCodec(codec)
+}
+
+// Failed encoding, reported when the statement binding it runs.
+type encodeError struct {
+	err error
+}
+
+func (self encodeError) MarshalCQL(info gocql.TypeInfo) ([]byte, error) {
+	return nil, self.err
+}
+
+// Value bound in statements for the provided value, encoded if it has a codec.
+func (self *DataAccess) bind(val reflect.Value) interface{} {
+	if codec := self.registry.codec(val.Type()); codec != nil {
+		stored, err := codec.Encode(val.Interface())
+		if err != nil {
+			return encodeError{fmt.Errorf("dago: encoding %s: %w", val.Type(), err)}
+		}
+		return stored
+	}
+	return bindValue(val)
+}
+
+// Generated mapper of the DAO, nil when it has none or some of its fields have codecs.
+func (self *DataAccess) mapperFor(dao interface{}) Mapper {
+	mapper := mapperFor(dao)
+	if mapper == nil || !self.registry.hasCodecs() {
+		return mapper
+	}
+	info, err := self.registry.Lookup(dao)
+	if err != nil {
+		return nil
+	}
+	for _, col := range info.Columns {
+		if self.registry.codec(col.Type) != nil {
+			return nil
+		}
+	}
+	return mapper
+}
+
+func (self *Registry) hasCodecs() bool {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	return len(self.codecs) > 0
+}
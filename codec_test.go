@@ -0,0 +1,67 @@
+package dago
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+type Hash [4]byte
+
+type CodecDao struct {
+	Hash   Hash `column:"hash,key"`
+	Parent Hash `column:"parent"`
+}
+
+func (self *CodecDao) TableName() string {
+	return "codec_dao"
+}
+
+var hashCodec = NewCodec("blob",
+	func(h Hash) ([]byte, error) {
+		if h == (Hash{}) {
+			return nil, errors.New("empty hash")
+		}
+		return h[:], nil
+	},
+	func(b []byte) (h Hash, err error) {
+		if len(b) != len(h) {
+			return h, errors.New("bad hash length")
+		}
+		copy(h[:], b)
+		return h, nil
+	})
+
+func TestCodec(t *testing.T) {
+	da := NewDataAccess(NewCQLHelper(nil))
+	da.RegisterCodec(hashCodec)
+	dao := &CodecDao{Hash{1, 2, 3, 4}, Hash{5, 6, 7, 8}}
+	assert.Equal(t, []*F{{"hash", []byte{1, 2, 3, 4}}, {"parent", []byte{5, 6, 7, 8}}}, da.Fields(dao))
+
+	values := da.fieldsZeroValuesArray(dao, []string{"Parent"})
+	*values[0].(*[]byte) = []byte{9, 9, 9, 9}
+	assert.NoError(t, da.setFieldsValues(dao, []string{"Parent"}, values))
+	assert.Equal(t, Hash{9, 9, 9, 9}, dao.Parent)
+	*values[0].(*[]byte) = []byte{9}
+	assert.EqualError(t, da.setFieldsValues(dao, []string{"Parent"}, values), "dago: decoding Parent: bad hash length")
+
+	// NULL columns aren't decoded
+	rec, nulls := newRecorder(func(st *Statement) ([][]interface{}, error) {
+		return [][]interface{}{{nil}}, nil
+	})
+	nulls.RegisterCodec(hashCodec)
+	found, err := nulls.Get(&CodecDao{Hash: Hash{1, 2, 3, 4}, Parent: Hash{5, 6, 7, 8}})
+	assert.NoError(t, err)
+	assert.Equal(t, Hash{}, found.(*CodecDao).Parent)
+	assert.Len(t, rec.statements, 1)
+
+	// encoding errors surface when running statements
+	bad := da.Fields(&CodecDao{Hash: Hash{1, 2, 3, 4}})[1].Value
+	_, err = gocql.Marshal(gocql.NewNativeType(4, gocql.TypeBlob, ""), bad)
+	assert.EqualError(t, err, "dago: encoding dago.Hash: empty hash")
+
+	info, _ := da.Registry().Lookup(dao)
+	assert.Equal(t, "blob", info.Schema(dao).Column("parent").Type)
+}
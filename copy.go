@@ -0,0 +1,272 @@
+package dago
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Copy of all rows of a table into other tables through a transformation, typically when
+// changing the primary key of a table. See DataAccess.CopyTable.
+type CopyJob struct {
+	// DAO of the type to read, values are ignored
+	Source DAOLite
+	// Destination DAOs to save for a source DAO, none to skip it
+	Transform func(src DAOLite) ([]DAOLite, error)
+	// DAOs saved concurrently, the DataAccess concurrency when not set
+	Concurrency int
+	// Maximum DAOs saved per second, unlimited when not set
+	Rate float64
+	// Source rows read between checkpoints, 1000 when not set
+	BatchSize int
+	// Called after each batch with the progress so far, to persist it
+	Checkpoint func(*CopyCheckpoint) error
+	// Progress of an interrupted run to resume from, nil to start from the beginning
+	Resume *CopyCheckpoint
+	// DAO of the destination type, to count rows once done, see CopyReport
+	Reconcile DAOLite
+}
+
+// Progress of a copy, all partitions with a token up to Token being copied. Tokens are the
+// ones of the Murmur3 partitioner, other ones being refused by CopyTable.
+type CopyCheckpoint struct {
+	Token   int64
+	Read    int
+	Written int
+}
+
+type CopyReport struct {
+	Read    int // source rows, including the ones of resumed runs
+	Written int // destination DAOs saved, including the ones of resumed runs
+	// Rows of the source and destination tables once done, when reconciling
+	SourceRows      int
+	DestinationRows int
+}
+
+// Full scans the source table in token order, transforms each source DAO and saves the
+// resulting DAOs, with bounded concurrency and rate. Progress is checkpointed after each
+// batch, once all DAOs of the batch are saved, at a partition boundary so that resuming
+// never skips rows. Rows of the partition being copied when interrupted are saved again.
+// Counts the rows of both tables once done when reconciling. Requires the Murmur3 partitioner.
+// Example:
+//
+//	report, err := da.CopyTable(&dago.CopyJob{
+//		Source: &TxByAddr{},
+//		Transform: func(src dago.DAOLite) ([]dago.DAOLite, error) {
+//			tx := src.(*TxByAddr)
+//			return []dago.DAOLite{&TxByAddrHeight{tx.Address, tx.Height, tx.Hash}}, nil
+//		},
+//		Rate:      5000,
+//		Reconcile: &TxByAddrHeight{},
+//	})
+func (self *DataAccess) CopyTable(job *CopyJob) (*CopyReport, error) {
+	da, span := self.startSpan("CopyTable", OpInsert, job.Source)
+	report, err := da.copyTable(job)
+	rows := 0
+	if report != nil {
+		rows = report.Written
+	}
+	return report, span.end(err, rows)
+}
+
+func (self *DataAccess) copyTable(job *CopyJob) (*CopyReport, error) {
+	if err := self.check(job.Source); err != nil {
+		return nil, err
+	}
+	concurrency, batchSize := job.Concurrency, job.BatchSize
+	if concurrency < 1 {
+		concurrency = self.concurrency
+	}
+	if batchSize < 1 {
+		batchSize = 1000
+	}
+	if err := self.helper.checkPartitioner(); err != nil {
+		return nil, err
+	}
+	progress := &CopyCheckpoint{Token: math.MinInt64}
+	if job.Resume != nil {
+		*progress = *job.Resume
+	}
+
+	srcType := reflect.TypeOf(job.Source).Elem()
+	fields := self.FieldNamesOfKind(job.Source, ANY)
+	helper := self.helperFor(job.Source)
+	iter := helper.tokenScan(self.tableOf(job.Source), self.ColNamesOfKind(job.Source, PARTITION_KEY),
+		progress.Token, self.ColNamesOfKind(job.Source, ANY))
+
+	limiter := newLimiter(job.Rate)
+	batch := make([]DAOLite, 0, batchSize)
+	// token of the last partition entirely read, and of the one being read
+	complete, current := progress.Token, progress.Token
+	read := 0 // source rows of the batch
+	flush := func() error {
+		written, err := self.saveAll(batch, concurrency, limiter)
+		progress.Written += written
+		if err != nil {
+			return err
+		}
+		progress.Read += read
+		progress.Token = complete
+		batch, read = batch[:0], 0
+		if job.Checkpoint != nil {
+			return job.Checkpoint(progress)
+		}
+		return nil
+	}
+
+	for {
+		src := reflect.New(srcType).Interface().(DAOLite)
+		var token int64
+		values := append(self.scanDests(src, fields), &token)
+		if !iter.Scan(values...) {
+			break
+		}
+		if err := self.applyScanned(src, fields, values[:len(fields)]); err != nil {
+			iter.Close()
+			return nil, err
+		}
+		if err := self.afterLoad(src); err != nil {
+			iter.Close()
+			return nil, err
+		}
+		if token != current {
+			complete, current = current, token
+		}
+		dsts, err := job.Transform(src)
+		if err != nil {
+			iter.Close()
+			return nil, err
+		}
+		batch = append(batch, dsts...)
+		read++
+		if read == batchSize {
+			if err := flush(); err != nil {
+				iter.Close()
+				return nil, err
+			}
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, classify(err)
+	}
+	complete = math.MaxInt64
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	report := &CopyReport{Read: progress.Read, Written: progress.Written}
+	if job.Reconcile != nil {
+		var err error
+		if report.SourceRows, err = self.CountRows(job.Source); err != nil {
+			return report, err
+		}
+		if report.DestinationRows, err = self.CountRows(job.Reconcile); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// Saves the DAOs concurrently, returning the number saved.
+func (self *DataAccess) saveAll(daos []DAOLite, concurrency int, limiter *limiter) (int, error) {
+	errs := make([]error, len(daos))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for n, dao := range daos {
+		wg.Add(1)
+		sem <- struct{}{}
+		limiter.wait()
+		go func(n int, dao DAOLite) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[n] = self.Save(dao)
+		}(n, dao)
+	}
+	wg.Wait()
+	saved := 0
+	for _, err := range errs {
+		if err == nil {
+			saved++
+		}
+	}
+	return saved, errors.Join(errs...)
+}
+
+// Counts the rows of the table of the DAO with a full scan of its keys.
+func (self *DataAccess) CountRows(dao DAOLite) (int, error) {
+	if err := self.check(dao); err != nil {
+		return 0, err
+	}
+	keys := self.ColNamesOfKind(dao, ANY_KEY)
+	iter := self.helperFor(dao).FullScanIter(self.tableOf(dao), keys...)
+	dests := make([]interface{}, len(keys))
+	for n := range dests {
+		dests[n] = new(interface{})
+	}
+	rows := 0
+	for iter.Scan(dests...) {
+		rows++
+	}
+	return rows, classify(iter.Close())
+}
+
+// Spaces calls to wait to the rate per second, none when not positive.
+type limiter struct {
+	mutex    sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newLimiter(rate float64) *limiter {
+	if rate <= 0 {
+		return &limiter{}
+	}
+	return &limiter{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+func (self *limiter) wait() {
+	if self.interval == 0 {
+		return
+	}
+	self.mutex.Lock()
+	now := time.Now()
+	if self.next.Before(now) {
+		self.next = now
+	}
+	at := self.next
+	self.next = self.next.Add(self.interval)
+	self.mutex.Unlock()
+	time.Sleep(time.Until(at))
+}
+
+const murmur3Partitioner = "org.apache.cassandra.dht.Murmur3Partitioner"
+
+// Fails unless the cluster uses the Murmur3 partitioner, the only one with int64 tokens,
+// which checkpoints hold.
+func (self *CQLHelper) checkPartitioner() error {
+	iter := self.QueryIter("select partitioner from system.local")
+	var partitioner string
+	iter.Scan(&partitioner)
+	if err := iter.Close(); err != nil {
+		return classify(err)
+	}
+	if partitioner != murmur3Partitioner {
+		return errors.New("dago: tables can only be copied on clusters using " + murmur3Partitioner +
+			", not " + strconv.Quote(partitioner))
+	}
+	return nil
+}
+
+// Full scan going over partitions in token order, from the ones after the provided token,
+// the token of each row being scanned after the fields.
+func (self *CQLHelper) tokenScan(table string, partitionKeys []string, after int64, fields []string) Iter {
+	token := "token(" + joinColumns(partitionKeys) + ")"
+	q := "select " + joinColumns(fields) + ", " + token + " from " + table + " where " + token + " > ?"
+	st := self.statement(OpSelect, table, q, true, &F{token, after})
+	return self.iter(st)
+}
@@ -0,0 +1,139 @@
+package dago
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	start := time.Now()
+	limiter := newLimiter(200)
+	for n := 0; n < 5; n++ {
+		limiter.wait()
+	}
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+
+	start = time.Now()
+	unlimited := newLimiter(0)
+	for n := 0; n < 1000; n++ {
+		unlimited.wait()
+	}
+	assert.True(t, time.Since(start) < 20*time.Millisecond)
+}
+
+func TestCopyTableValidation(t *testing.T) {
+	da := NewDataAccess(NewCQLHelper(nil))
+	_, err := da.CopyTable(&CopyJob{Source: &NoKeyDao{}})
+	assert.Error(t, err)
+
+	// tokens of other partitioners don't fit checkpoints
+	rec, da := newRecorder(func(st *Statement) ([][]interface{}, error) {
+		return [][]interface{}{{"org.apache.cassandra.dht.RandomPartitioner"}}, nil
+	})
+	_, err = da.CopyTable(&CopyJob{Source: &HeightDao{}})
+	assert.EqualError(t, err, "dago: tables can only be copied on clusters using "+
+		"org.apache.cassandra.dht.Murmur3Partitioner, not \"org.apache.cassandra.dht.RandomPartitioner\"")
+	assert.Equal(t, []string{"select partitioner from system.local"}, rec.CQL())
+}
+
+type TxByHash struct {
+	Hash    string `column:"tx_hash,key"`
+	Address string `column:"address"`
+	Height  int64  `column:"bheight"`
+}
+
+func (self *TxByHash) TableName() string {
+	return "txs_by_hash"
+}
+
+func TestCopyTableResume(t *testing.T) {
+	// partitions in token order, the last one interrupted by a failing save
+	source := []struct {
+		out   *HeightDao
+		token int64
+	}{
+		{&HeightDao{"1a", 100, "h1", 1}, 10},
+		{&HeightDao{"1a", 101, "h2", 2}, 10},
+		{&HeightDao{"1b", 100, "h3", 3}, 20},
+		{&HeightDao{"1c", 102, "h4", 4}, 30},
+		{&HeightDao{"1c", 103, "h5", 5}, 30},
+	}
+	var mutex sync.Mutex
+	failing := true
+	saved := map[string]int{}
+	rec, da := newRecorder(func(st *Statement) ([][]interface{}, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch {
+		case st.CQL == "select partitioner from system.local":
+			return [][]interface{}{{murmur3Partitioner}}, nil
+		case st.Op == OpInsert:
+			if failing && st.Values[0] == "h5" {
+				return nil, errors.New("write failed")
+			}
+			saved[st.Values[0].(string)]++
+		case strings.HasPrefix(st.CQL, "select address, bheight, tx_hash, value, token(address)"):
+			rows := [][]interface{}{}
+			for _, src := range source {
+				if src.token > st.Values[0].(int64) {
+					rows = append(rows, []interface{}{src.out.Address, src.out.Height, src.out.Hash, src.out.Value, src.token})
+				}
+			}
+			return rows, nil
+		case st.Table == "addr_outputs":
+			return keyRows(len(source), 3), nil
+		case st.Table == "txs_by_hash":
+			return keyRows(len(saved), 1), nil
+		}
+		return nil, nil
+	})
+	checkpoints := []CopyCheckpoint{}
+	job := &CopyJob{
+		Source: &HeightDao{},
+		Transform: func(src DAOLite) ([]DAOLite, error) {
+			out := src.(*HeightDao)
+			return []DAOLite{&TxByHash{out.Hash, out.Address, out.Height}}, nil
+		},
+		BatchSize: 2,
+		Checkpoint: func(progress *CopyCheckpoint) error {
+			checkpoints = append(checkpoints, *progress)
+			return nil
+		},
+		Reconcile: &TxByHash{},
+	}
+	_, err := da.CopyTable(job)
+	assert.EqualError(t, err, "write failed")
+	// checkpoints only cover partitions entirely read and saved
+	assert.Equal(t, []CopyCheckpoint{{math.MinInt64, 2, 2}, {20, 4, 4}}, checkpoints)
+	assert.Equal(t, map[string]int{"h1": 1, "h2": 1, "h3": 1, "h4": 1}, saved)
+
+	// resuming reads the interrupted partition again
+	failing = false
+	rec.statements = nil
+	job.Resume = &checkpoints[len(checkpoints)-1]
+	checkpoints = checkpoints[:0]
+	report, err := da.CopyTable(job)
+	assert.NoError(t, err)
+	assert.Equal(t, "select address, bheight, tx_hash, value, token(address) from addr_outputs where token(address) > ?",
+		rec.statements[1].CQL)
+	assert.Equal(t, []interface{}{int64(20)}, rec.statements[1].Values)
+	assert.Equal(t, []CopyCheckpoint{{20, 6, 6}, {math.MaxInt64, 6, 6}}, checkpoints)
+	assert.Equal(t, map[string]int{"h1": 1, "h2": 1, "h3": 1, "h4": 2, "h5": 1}, saved)
+	// counts include the rows saved again, reconciliation the rows of both tables
+	assert.Equal(t, &CopyReport{Read: 6, Written: 6, SourceRows: 5, DestinationRows: 5}, report)
+}
+
+// Rows of null key values, for counts.
+func keyRows(n, keys int) [][]interface{} {
+	rows := make([][]interface{}, n)
+	for i := range rows {
+		rows[i] = make([]interface{}, keys)
+	}
+	return rows
+}
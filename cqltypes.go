@@ -0,0 +1,286 @@
+package dago
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"gopkg.in/inf.v0"
+)
+
+// Go types used for simple CQL types, following gocql's defaults, along with the package
+// to import if any.
+var cqlGoTypes = map[string][2]string{
+	"ascii":     {"string", ""},
+	"text":      {"string", ""},
+	"varchar":   {"string", ""},
+	"inet":      {"string", ""},
+	"bigint":    {"int64", ""},
+	"counter":   {"int64", ""},
+	"int":       {"int32", ""},
+	"smallint":  {"int16", ""},
+	"tinyint":   {"int8", ""},
+	"varint":    {"*big.Int", "math/big"},
+	"decimal":   {"*inf.Dec", "gopkg.in/inf.v0"},
+	"float":     {"float32", ""},
+	"double":    {"float64", ""},
+	"boolean":   {"bool", ""},
+	"blob":      {"[]byte", ""},
+	"timestamp": {"time.Time", "time"},
+	"date":      {"time.Time", "time"},
+	"time":      {"time.Duration", "time"},
+	"duration":  {"gocql.Duration", "github.com/gocql/gocql"},
+	"uuid":      {"gocql.UUID", "github.com/gocql/gocql"},
+	"timeuuid":  {"gocql.UUID", "github.com/gocql/gocql"},
+}
+
+// Go type to use for a CQL type, as written in Go source, along with the packages it
+// requires. User defined types and tuples map to generic maps and slices.
+// Example:
+//
+//	GoTypeOf("map<text, frozen<list<int>>>") // map[string][]int32
+func GoTypeOf(cqlType string) (string, []string) {
+	imports := make(map[string]bool)
+	typ := goTypeOf(normalizeType(cqlType), imports)
+	pkgs := make([]string, 0, len(imports))
+	for pkg := range imports {
+		pkgs = append(pkgs, pkg)
+	}
+	return typ, pkgs
+}
+
+func goTypeOf(cqlType string, imports map[string]bool) string {
+	if gt, ok := cqlGoTypes[cqlType]; ok {
+		if gt[1] != "" {
+			imports[gt[1]] = true
+		}
+		return gt[0]
+	}
+	lt := strings.Index(cqlType, "<")
+	if lt < 0 || !strings.HasSuffix(cqlType, ">") {
+		// user defined type
+		return "map[string]interface{}"
+	}
+	params := splitTopLevel(cqlType[lt+1:len(cqlType)-1], ',')
+	for n := range params {
+		params[n] = strings.TrimSpace(params[n])
+	}
+	switch cqlType[:lt] {
+	case "frozen":
+		return goTypeOf(params[0], imports)
+	case "list", "set":
+		return "[]" + goTypeOf(params[0], imports)
+	case "map":
+		if len(params) == 2 {
+			return "map[" + goTypeOf(params[0], imports) + "]" + goTypeOf(params[1], imports)
+		}
+	}
+	return "[]interface{}"
+}
+
+// CQL type to use for a Go type, the reverse of GoTypeOf, empty when there is none.
+// Example:
+//
+//	CQLTypeOf(reflect.TypeOf(map[string][]int32{})) // map<text, frozen<list<int>>>
+func CQLTypeOf(t reflect.Type) string {
+	return cqlTypeOf(t, false)
+}
+
+var nullType = reflect.TypeOf(Null[int]{})
+
+func cqlTypeOf(t reflect.Type, nested bool) string {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return "timestamp"
+	case reflect.TypeOf(time.Duration(0)):
+		return "bigint"
+	case reflect.TypeOf(gocql.UUID{}):
+		return "uuid"
+	case reflect.TypeOf(gocql.Duration{}):
+		return "duration"
+	case reflect.TypeOf(new(big.Int)):
+		return "varint"
+	case reflect.TypeOf(new(inf.Dec)):
+		return "decimal"
+	}
+	frozen := func(typ string) string {
+		if nested {
+			return "frozen<" + typ + ">"
+		}
+		return typ
+	}
+	if typ := narrowestCQLType(t.Kind()); typ != "" {
+		return typ
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return cqlTypeOf(t.Elem(), nested)
+	case reflect.Struct:
+		if t.PkgPath() == nullType.PkgPath() && strings.HasPrefix(t.Name(), "Null[") {
+			return cqlTypeOf(t.Field(0).Type, nested)
+		}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			if t.Kind() == reflect.Array {
+				// not marshalled by gocql, unless through a codec
+				return ""
+			}
+			return "blob"
+		}
+		if elem := cqlTypeOf(t.Elem(), true); elem != "" {
+			return frozen("list<" + elem + ">")
+		}
+	case reflect.Map:
+		key, elem := cqlTypeOf(t.Key(), true), cqlTypeOf(t.Elem(), true)
+		if key != "" && elem != "" {
+			return frozen("map<" + key + ", " + elem + ">")
+		}
+	}
+	return ""
+}
+
+// Kinds of the Go values each simple CQL type can hold without loss or overflow, other
+// types being checked separately.
+var cqlKinds = map[string][]reflect.Kind{
+	"tinyint":  {reflect.Int8},
+	"smallint": {reflect.Int16, reflect.Int8, reflect.Uint8},
+	"int":      {reflect.Int32, reflect.Int16, reflect.Int8, reflect.Uint16, reflect.Uint8},
+	"bigint": {reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8,
+		reflect.Uint32, reflect.Uint16, reflect.Uint8},
+	"counter": {reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8,
+		reflect.Uint32, reflect.Uint16, reflect.Uint8},
+	"varint": {reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8,
+		reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16, reflect.Uint8},
+	"float":   {reflect.Float32},
+	"double":  {reflect.Float64, reflect.Float32},
+	"boolean": {reflect.Bool},
+	"ascii":   {reflect.String},
+	"text":    {reflect.String},
+	"varchar": {reflect.String},
+	"inet":    {reflect.String},
+	"blob":    {reflect.String},
+	"uuid":    {reflect.String},
+}
+
+// Simple CQL types from the narrowest, the CQL type of a Go kind being the first one whose
+// cqlKinds hold it, so that CQLTypeOf and checkCQLType always agree.
+var cqlTypesByWidth = []string{"tinyint", "smallint", "int", "bigint", "varint", "float", "double", "boolean",
+	"text"}
+
+func narrowestCQLType(kind reflect.Kind) string {
+	for _, typ := range cqlTypesByWidth {
+		for _, k := range cqlKinds[typ] {
+			if k == kind {
+				return typ
+			}
+		}
+	}
+	return ""
+}
+
+// Error when values of the Go type can't be stored in columns of the CQL type, nil when they
+// can or the types can't be checked, like user defined types and types marshalling
+// themselves.
+func checkCQLType(t reflect.Type, cqlType string) error {
+	cqlType = normalizeType(cqlType)
+	if t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) {
+		if t.Kind() == reflect.Struct && t.PkgPath() == nullType.PkgPath() && strings.HasPrefix(t.Name(), "Null[") {
+			return checkCQLType(t.Field(0).Type, cqlType)
+		}
+		return nil
+	}
+	if t.Kind() == reflect.Ptr && t != reflect.TypeOf(new(big.Int)) && t != reflect.TypeOf(new(inf.Dec)) {
+		return checkCQLType(t.Elem(), cqlType)
+	}
+	if strings.HasPrefix(cqlType, "frozen<") {
+		cqlType = cqlType[len("frozen<") : len(cqlType)-1]
+	}
+	fail := fmt.Errorf("%s values can't be stored in %s columns", t, cqlType)
+
+	if lt := strings.Index(cqlType, "<"); lt >= 0 && strings.HasSuffix(cqlType, ">") {
+		params := splitTopLevel(cqlType[lt+1:len(cqlType)-1], ',')
+		for n := range params {
+			params[n] = strings.TrimSpace(params[n])
+		}
+		switch cqlType[:lt] {
+		case "list", "set":
+			if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+				return fail
+			}
+			return checkCQLType(t.Elem(), params[0])
+		case "map":
+			if t.Kind() != reflect.Map || len(params) != 2 {
+				return fail
+			}
+			if err := checkCQLType(t.Key(), params[0]); err != nil {
+				return err
+			}
+			return checkCQLType(t.Elem(), params[1])
+		}
+		// tuples and vectors
+		return nil
+	}
+
+	switch cqlType {
+	case "blob":
+		// gocql doesn't marshal byte arrays, fields of such types need a codec
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+	case "varint":
+		if t == reflect.TypeOf(new(big.Int)) {
+			return nil
+		}
+	case "decimal":
+		if t == reflect.TypeOf(new(inf.Dec)) {
+			return nil
+		}
+		return fail
+	case "timestamp":
+		if t == reflect.TypeOf(time.Time{}) || t.Kind() == reflect.Int64 && t != durationType {
+			return nil
+		}
+		return fail
+	case "date":
+		if t == reflect.TypeOf(time.Time{}) {
+			return nil
+		}
+		return fail
+	case "time":
+		if t.Kind() == reflect.Int64 {
+			return nil
+		}
+		return fail
+	case "duration":
+		if t == reflect.TypeOf(gocql.Duration{}) || t == durationType {
+			return nil
+		}
+		return fail
+	case "uuid", "timeuuid":
+		if t == reflect.TypeOf(gocql.UUID{}) || t.Kind() == reflect.Array && t.Len() == 16 && t.Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+	case "inet":
+		if t == reflect.TypeOf(net.IP{}) {
+			return nil
+		}
+	}
+	kinds, known := cqlKinds[cqlType]
+	if !known {
+		// user defined types
+		return nil
+	}
+	if t == durationType && cqlType != "bigint" {
+		return fail
+	}
+	for _, kind := range kinds {
+		if t.Kind() == kind {
+			return nil
+		}
+	}
+	return fail
+}
@@ -1,10 +1,13 @@
 package dago
 
 import (
+	"context"
+	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/gocql/gocql"
 )
@@ -43,11 +46,28 @@ type DAOPostHook interface {
 	PostLoad()
 }
 
+// Default maximum number of queries a DataAccess runs concurrently when an operation fans
+// out over many rows.
+const DefaultConcurrency = 16
+
 type DataAccess struct {
 	helper *CQLHelper
 
-	fieldDefsCache map[string][]*fieldDef
-	defMutex       *sync.RWMutex
+	registry *Registry
+	// keyspace and table names overriding the registered ones, see In and MapTables
+	keyspace string
+	tables   map[string]string
+
+	unsetEmpty     bool
+	allowFiltering bool
+	concurrency    int
+	ctx            context.Context
+	// retry policy of idempotent statements, the helper's one when nil
+	retry gocql.RetryPolicy
+
+	// rows read by Get, see WithCache
+	cache   Cache
+	flights *flightGroup
 }
 
 type Iter interface {
@@ -55,13 +75,16 @@ type Iter interface {
 	Scan(dest ...interface{}) bool
 }
 
-// field definition for a DAO, cached by type name to avoid recomputing
+// field definition for a DAO, held by the registry to avoid recomputing
 // on each operation
 type fieldDef struct {
-	pos  int // field index in the struct
-	name string
-	col  string
-	kind colKind
+	pos       int // field index in the struct
+	name      string
+	col       string
+	kind      colKind
+	redact    bool   // value must never be displayed
+	omitEmpty bool   // empty values aren't written
+	index     string // secondary index class, empty when not indexed
 }
 
 func (self *fieldDef) String() string {
@@ -69,24 +92,141 @@ func (self *fieldDef) String() string {
 }
 
 func NewDataAccess(helper *CQLHelper) *DataAccess {
-	return &DataAccess{helper, make(map[string][]*fieldDef), new(sync.RWMutex)}
+	return &DataAccess{helper, NewRegistry(), "", nil, false, false, DefaultConcurrency, context.Background(), nil, nil, nil}
+}
+
+// Returns a copy of the DataAccess running all its operations against tables of the provided
+// keyspace, so identical DAOs can be stored in several keyspaces.
+// Example:
+//
+//	testnet := da.In("testnet3")
+//	tx, err := testnet.Get(&Tx{Hash: hash})
+func (self *DataAccess) In(keyspace string) *DataAccess {
+	da := *self
+	da.keyspace = keyspace
+	return &da
+}
+
+// Returns a copy of the DataAccess using other table names, the mapping going from the
+// registered table names, or the ones returned by TableName, to the ones to use. Mappings
+// add to the ones already set.
+// Example:
+//
+//	archive := da.MapTables(map[string]string{"txs": "txs_2017", "blocks": "blocks_2017"})
+func (self *DataAccess) MapTables(mapping map[string]string) *DataAccess {
+	da := *self
+	da.tables = make(map[string]string, len(self.tables)+len(mapping))
+	for from, to := range self.tables {
+		da.tables[from] = to
+	}
+	for from, to := range mapping {
+		da.tables[from] = to
+	}
+	return &da
+}
+
+// Returns a copy of the DataAccess running all its queries and hooks with the provided
+// context.
+// Example:
+//
+//	user, err := da.WithContext(ctx).Get(&User{Country: "US", SSN: "890-123-4567"})
+func (self *DataAccess) WithContext(ctx context.Context) *DataAccess {
+	da := *self
+	da.ctx = ctx
+	da.helper = self.helper.withContext(ctx)
+	return &da
+}
+
+// Sets the maximum number of queries run concurrently by operations going over many rows,
+// like GetMany.
+func (self *DataAccess) SetConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	self.concurrency = n
+}
+
+// Binds empty values of omitempty fields as unset instead of leaving their columns out of
+// writes, so that saving DAOs of a type always uses the same statement. Requires protocol
+// version 4 or later.
+func (self *DataAccess) SetUnsetEmpty(unset bool) {
+	self.unsetEmpty = unset
+}
+
+// Sets the retry policy for all idempotent statements of the DataAccess, see
+// ExponentialRetryPolicy. The DataAccess it was copied from, if any, keeps its own, the
+// helper being shared.
+func (self *DataAccess) SetRetryPolicy(policy gocql.RetryPolicy) {
+	self.retry = policy
 }
 
 // Saves a new row or updates an existing one using all field values for the provided DAO.
 func (self *DataAccess) Save(dao DAOLite) error {
-	return self.SaveTable(dao.TableName(), dao)
+	da, span := self.startSpan("Save", OpInsert, dao)
+	return span.endRow(da.save(dao))
 }
 
-// Same as save but allows overriding the table name
+func (self *DataAccess) save(dao DAOLite) error {
+	if err := self.checkWrite(dao); err != nil {
+		return err
+	}
+	if info := self.denormalized(dao); info != nil {
+		defer self.uncache(self.tableOf(dao), dao)
+		return self.saveDenormalized(dao, info, nil)
+	}
+	return self.saveTable(self.tableOf(dao), dao)
+}
+
+// Same as save but allows overriding the table name, mapped and qualified with the keyspace
+// of the DataAccess if any. Only saves to that table.
 func (self *DataAccess) SaveTable(tableName string, dao DAOLite) error {
-	if daopre, ok := dao.(DAOPreHook); ok {
-		daopre.PreSave()
+	if err := self.checkWrite(dao); err != nil {
+		return err
 	}
-	params := self.Fields(dao)
-	res := self.helper.Save(tableName, params...)
-	if daopost, ok := dao.(DAOPostSaveHook); ok {
-		daopost.PostSave()
+	return self.saveTable(self.qualify(tableName, ""), dao)
+}
+
+// Saves the DAO to the table, already mapped and qualified.
+func (self *DataAccess) saveTable(table string, dao DAOLite) error {
+	if err := self.beforeSave(dao); err != nil {
+		return err
 	}
+	params, err := self.saveFields(dao, nil)
+	if err != nil {
+		return err
+	}
+	res := self.helperFor(dao).Save(table, params...)
+	// rows are only cached under the table of the DAO, which Get reads
+	self.uncache(self.tableOf(dao), dao)
+	self.afterSave(dao, res)
+	return res
+}
+
+// Saves a new row only if no row exists with the same primary keys, returning
+// ErrLWTNotApplied otherwise.
+func (self *DataAccess) SaveIfNotExists(dao DAOLite) error {
+	da, span := self.startSpan("SaveIfNotExists", OpInsert, dao)
+	return span.endRow(da.saveIfNotExists(dao))
+}
+
+func (self *DataAccess) saveIfNotExists(dao DAOLite) error {
+	if err := self.checkWrite(dao); err != nil {
+		return err
+	}
+	if self.denormalized(dao) != nil {
+		return errSecondaryLWT
+	}
+	if err := self.beforeSave(dao); err != nil {
+		return err
+	}
+	params, err := self.saveFields(dao, nil)
+	if err != nil {
+		return err
+	}
+	helper := self.helperFor(dao)
+	res := helper.execCAS(helper.save(self.tableOf(dao), true, params...))
+	self.uncache(self.tableOf(dao), dao)
+	self.afterSave(dao, res)
 	return res
 }
 
@@ -94,11 +234,28 @@ func (self *DataAccess) SaveTable(tableName string, dao DAOLite) error {
 // of provided fields. Fields are simply the string name of the corresponding  DAO struct
 // field.
 func (self *DataAccess) SavePartial(dao DAOLite, fields ...string) error {
-	if daopre, ok := dao.(DAOPreHook); ok {
-		daopre.PreSave()
+	da, span := self.startSpan("SavePartial", OpInsert, dao)
+	return span.endRow(da.savePartial(dao, fields...))
+}
+
+func (self *DataAccess) savePartial(dao DAOLite, fields ...string) error {
+	if err := self.checkWrite(dao); err != nil {
+		return err
+	}
+	defer self.uncache(self.tableOf(dao), dao)
+	if info := self.denormalized(dao); info != nil {
+		return self.saveDenormalized(dao, info, fields)
+	}
+	if err := self.beforeSave(dao); err != nil {
+		return err
+	}
+	params, err := self.saveFields(dao, fields)
+	if err != nil {
+		return err
 	}
-	params := append(self.Keys(dao), self.fieldsOfKind(dao, NON_KEY, fields)...)
-	return self.helper.Save(dao.TableName(), params...)
+	res := self.helperFor(dao).Save(self.tableOf(dao), params...)
+	self.afterSave(dao, res)
+	return res
 }
 
 // Accepts a DAO with primary keys fields set and gets the corresponding row, setting the
@@ -108,31 +265,52 @@ func (self *DataAccess) SavePartial(dao DAOLite, fields ...string) error {
 //
 //	user, err := da.Get(&User{Country: "US", SSN: "890-123-4567"})
 func (self *DataAccess) Get(dao DAOLite) (DAOLite, error) {
+	da, span := self.startSpan("Get", OpSelect, dao)
+	res, err := da.get(dao)
+	return res, span.endRow(err)
+}
+
+func (self *DataAccess) get(dao DAOLite) (DAOLite, error) {
+	if err := self.check(dao); err != nil {
+		return nil, err
+	}
+	if self.cache != nil {
+		if info, err := self.registry.Lookup(dao); err == nil && info.CacheTTL > 0 {
+			return self.cachedGet(dao, info.CacheTTL)
+		}
+	}
 	return self.GetBy(self.Keys(dao), dao)
 }
 
 // Gets a DAO using the provided keys instead of inferring the keys from the DAO annotations.
 func (self *DataAccess) GetBy(keys []*F, dao DAOLite) (DAOLite, error) {
-	return self.GetByTable(dao.TableName(), keys, dao)
+	return self.GetByTable(self.tableOf(dao), keys, dao)
 }
 
+// Same as GetBy but allows overriding the table name, qualified with the keyspace of the
+// DataAccess if any.
 func (self *DataAccess) GetByTable(table string, keys []*F, dao DAOLite) (DAOLite, error) {
+	if err := self.check(dao); err != nil {
+		return nil, err
+	}
 	colsToGet := self.ColNamesOfKind(dao, NON_KEY)
 	fieldsToGet := self.FieldNamesOfKind(dao, NON_KEY)
-	values := self.fieldsZeroValuesArray(dao, fieldsToGet)
+	values := self.scanDests(dao, fieldsToGet)
 
-	iter := self.helper.GetN(table, keys, colsToGet...).Iter()
+	helper := self.helperFor(dao)
+	iter := helper.run(helper.getN(self.qualify(table, ""), keys, "", colsToGet))
 	found := iter.Scan(values...)
 	if err := iter.Close(); err != nil {
-		return nil, err
+		return nil, classify(err)
 	}
 	if !found {
 		return nil, gocql.ErrNotFound
 	}
-	self.setFieldsValues(dao, fieldsToGet, values)
-
-	if daopost, ok := dao.(DAOPostHook); ok {
-		daopost.PostLoad()
+	if err := self.applyScanned(dao, fieldsToGet, values); err != nil {
+		return nil, err
+	}
+	if err := self.afterLoad(dao); err != nil {
+		return nil, err
 	}
 	return dao, nil
 }
@@ -147,100 +325,263 @@ func (self *DataAccess) GetByTable(table string, keys []*F, dao DAOLite) (DAOLit
 //	for da.Next(iter, user) {...}
 //	iter.Close()
 func (self *DataAccess) PartitionIter(dao DAOLite) Iter {
+	if err := self.check(dao); err != nil {
+		return ErrorIter(err)
+	}
+	colsToGet := append(self.ColNamesOfKind(dao, NON_KEY), self.ColNamesOfKind(dao, CLUSTERING_KEY)...)
+	helper := self.helperFor(dao)
+	st := helper.getN(self.tableOf(dao), self.PartitionKeys(dao), "", colsToGet)
+	return &hookIter{Iter: helper.iter(st)}
+}
+
+// Same as PartitionIter but only goes over the rows within the bounds, named after the DAO
+// clustering key fields.
+// Example:
+//
+//	iter := da.PartitionIterRange(output, dago.Gt("Height", forkHeight))
+func (self *DataAccess) PartitionIterRange(dao DAOLite, bounds ...*Bound) Iter {
+	if err := self.check(dao); err != nil {
+		return ErrorIter(err)
+	}
+	colBounds, err := self.colBounds(dao, bounds)
+	if err != nil {
+		return ErrorIter(err)
+	}
 	colsToGet := append(self.ColNamesOfKind(dao, NON_KEY), self.ColNamesOfKind(dao, CLUSTERING_KEY)...)
-	q := self.helper.GetN(dao.TableName(), self.PartitionKeys(dao), colsToGet...)
-	return q.PageSize(2000).Consistency(gocql.LocalQuorum).Iter()
+	helper := self.helperFor(dao)
+	st := helper.getNRange(self.tableOf(dao), self.PartitionKeys(dao), colBounds, colsToGet)
+	return &hookIter{Iter: helper.iter(st)}
 }
 
 func (self *DataAccess) PartitionIterLimit(dao DAOLite, limit int) Iter {
+	if err := self.check(dao); err != nil {
+		return ErrorIter(err)
+	}
 	colsToGet := append(self.ColNamesOfKind(dao, NON_KEY), self.ColNamesOfKind(dao, CLUSTERING_KEY)...)
-	q := self.helper.GetNLimit(dao.TableName(), limit, self.PartitionKeys(dao), colsToGet...)
-	return q.PageSize(2000).Consistency(gocql.LocalQuorum).Iter()
+	helper := self.helperFor(dao)
+	st := helper.getN(self.tableOf(dao), self.PartitionKeys(dao), limitClause(limit), colsToGet)
+	return &hookIter{Iter: helper.iter(st)}
 }
 
 func (self *DataAccess) PartitionIterLimitFilterBeforeBlockHeight(dao DAOLite, limit int, blockHeight uint) Iter {
+	if err := self.check(dao); err != nil {
+		return ErrorIter(err)
+	}
 	colsToGet := append(self.ColNamesOfKind(dao, NON_KEY), self.ColNamesOfKind(dao, CLUSTERING_KEY)...)
-	q := self.helper.GetNLimitFilterBeforeBlockHeight(dao.TableName(), limit, blockHeight, self.PartitionKeys(dao), colsToGet...)
-	return q.PageSize(2000).Consistency(gocql.LocalQuorum).Iter()
+	helper := self.helperFor(dao)
+	st := helper.getN(self.tableOf(dao), self.PartitionKeys(dao), beforeBHClause(blockHeight)+limitClause(limit), colsToGet)
+	return &hookIter{Iter: helper.iter(st)}
 }
 
 func (self *DataAccess) PartitionIterLimitFilterAfterBlockHeight(dao DAOLite, limit int, blockHeight uint) Iter {
+	if err := self.check(dao); err != nil {
+		return ErrorIter(err)
+	}
 	colsToGet := append(self.ColNamesOfKind(dao, NON_KEY), self.ColNamesOfKind(dao, CLUSTERING_KEY)...)
-	q := self.helper.GetNLimitFilterAfterBlockHeight(dao.TableName(), limit, blockHeight, self.PartitionKeys(dao), colsToGet...)
-	return q.PageSize(2000).Consistency(gocql.LocalQuorum).Iter()
+	helper := self.helperFor(dao)
+	st := helper.getN(self.tableOf(dao), self.PartitionKeys(dao), afterBHClause(blockHeight)+limitClause(limit), colsToGet)
+	return &hookIter{Iter: helper.iter(st)}
 }
 
 func (self *DataAccess) PartitionIterLimitFilterBlockHeights(dao DAOLite, limit int, beforeBH, afterBH uint) Iter {
+	if err := self.check(dao); err != nil {
+		return ErrorIter(err)
+	}
 	colsToGet := append(self.ColNamesOfKind(dao, NON_KEY), self.ColNamesOfKind(dao, CLUSTERING_KEY)...)
-	q := self.helper.GetNLimitFilterBlockHeights(dao.TableName(), limit, beforeBH, afterBH, self.PartitionKeys(dao), colsToGet...)
-	return q.PageSize(2000).Consistency(gocql.LocalQuorum).Iter()
+	helper := self.helperFor(dao)
+	st := helper.getN(self.tableOf(dao), self.PartitionKeys(dao),
+		beforeBHClause(beforeBH)+afterBHClause(afterBH)+limitClause(limit), colsToGet)
+	return &hookIter{Iter: helper.iter(st)}
 }
 
 func (self *DataAccess) FullIter(dao DAOLite) Iter {
-	colsToGet := append(self.ColNamesOfKind(dao, ANY), self.ColNamesOfKind(dao, CLUSTERING_KEY)...)
-	return self.helper.FullScan(dao.TableName(), colsToGet...)
+	if err := self.check(dao); err != nil {
+		return ErrorIter(err)
+	}
+	iter := self.helperFor(dao).FullScanIter(self.tableOf(dao), self.ColNamesOfKind(dao, ANY)...)
+	return &hookIter{Iter: iter, fields: self.FieldNamesOfKind(dao, ANY)}
 }
 
-// See PartitionIter
+// See PartitionIter. Stops when a DAOAfterLoadHook fails, the error being returned when
+// closing iterators created by the DataAccess.
 func (self *DataAccess) Next(iter Iter, dao DAOLite) bool {
+	if err := self.check(dao); err != nil {
+		if hiter, ok := iter.(*hookIter); ok {
+			hiter.err = err
+		}
+		return false
+	}
 	fieldsToGet := append(self.FieldNamesOfKind(dao, NON_KEY), self.FieldNamesOfKind(dao, CLUSTERING_KEY)...)
-	values := self.fieldsZeroValuesArray(dao, fieldsToGet)
+	if hiter, ok := iter.(*hookIter); ok && hiter.fields != nil {
+		fieldsToGet = hiter.fields
+	}
+	values := self.scanDests(dao, fieldsToGet)
 	next := iter.Scan(values...)
 	if !next {
 		return false
 	}
-	self.setFieldsValues(dao, fieldsToGet, values)
-	if daopost, ok := dao.(DAOPostHook); ok {
-		daopost.PostLoad()
+	err := self.applyScanned(dao, fieldsToGet, values)
+	if err == nil {
+		err = self.afterLoad(dao)
+	}
+	if err != nil {
+		if hiter, ok := iter.(*hookIter); ok {
+			hiter.err = err
+		}
+		return false
 	}
 	return true
 }
 
+// Scan destinations for the provided fields, to be applied to the DAO with applyScanned.
+// Destinations point directly to the DAO fields when it has a mapper.
+func (self *DataAccess) scanDests(dao DAOLite, fieldNames []string) []interface{} {
+	if mapper := self.mapperFor(dao); mapper != nil {
+		dests := make([]interface{}, len(fieldNames))
+		for n, field := range fieldNames {
+			dests[n] = mapper.Dest(dao, field)
+		}
+		return dests
+	}
+	return self.fieldsZeroValuesArray(dao, fieldNames)
+}
+
+func (self *DataAccess) applyScanned(dao DAOLite, fieldNames []string, values []interface{}) error {
+	if self.mapperFor(dao) == nil {
+		return self.setFieldsValues(dao, fieldNames, values)
+	}
+	return nil
+}
+
 func (self *DataAccess) fieldsZeroValuesArray(dao DAOLite, fieldNames []string) []interface{} {
 	v := reflect.ValueOf(dao).Elem()
 	values := make([]interface{}, 0, len(fieldNames))
 	for _, field := range fieldNames {
-		values = append(values, reflect.New(v.FieldByName(field).Type()).Interface())
+		t := v.FieldByName(field).Type()
+		if codec := self.registry.codec(t); codec != nil {
+			t = codec.StoredType()
+		}
+		values = append(values, reflect.New(t).Interface())
 	}
 	return values
 }
 
-func (self *DataAccess) setFieldsValues(dao DAOLite, fieldNames []string, values []interface{}) {
+func (self *DataAccess) setFieldsValues(dao DAOLite, fieldNames []string, values []interface{}) error {
 	v := reflect.ValueOf(dao).Elem()
 	valn := 0
 	for _, field := range fieldNames {
 		sf := v.FieldByName(field)
-		if values[valn] != nil {
-			valof := reflect.ValueOf(values[valn])
-			sf.Set(valof.Elem())
-		} else {
+		codec := self.registry.codec(sf.Type())
+		switch {
+		case values[valn] == nil:
+			sf.Set(reflect.Zero(sf.Type()))
+		case codec == nil:
+			sf.Set(reflect.ValueOf(values[valn]).Elem())
+		case isEmpty(reflect.ValueOf(values[valn]).Elem()):
+			// NULL columns are scanned as zero values, codecs not having to handle them
 			sf.Set(reflect.Zero(sf.Type()))
+		default:
+			decoded, err := codec.Decode(reflect.ValueOf(values[valn]).Elem().Interface())
+			if err != nil {
+				return fmt.Errorf("dago: decoding %s: %w", field, err)
+			}
+			sf.Set(reflect.ValueOf(decoded))
 		}
 		valn++
 	}
+	return nil
+}
+
+// CQL helper issuing statements on behalf of the provided DAO, with the retry policy of the
+// DataAccess.
+func (self *DataAccess) helperFor(dao interface{}) *CQLHelper {
+	info, err := self.registry.Lookup(dao)
+	if err != nil {
+		info = &DAOInfo{Type: reflect.TypeOf(dao)}
+	}
+	helper := self.helper.forDAO(info)
+	if self.retry != nil {
+		helper.retry = self.retry
+	}
+	return helper
+}
+
+// Table of the provided DAO, as registered or returned by TableName, mapped and qualified
+// with the keyspace of the DataAccess.
+func (self *DataAccess) tableOf(dao DAOLite) string {
+	info, err := self.registry.Lookup(dao)
+	if err != nil {
+		return self.qualify(dao.TableName(), "")
+	}
+	return self.qualify(info.tableFor(dao), info.Keyspace)
+}
+
+// Maps the table name and qualifies it with the keyspace of the DataAccess if set, or the
+// provided one. Names already qualified are only mapped.
+func (self *DataAccess) qualify(table, keyspace string) string {
+	if mapped, ok := self.tables[table]; ok {
+		table = mapped
+	}
+	if strings.Contains(table, ".") {
+		return table
+	}
+	if self.keyspace != "" {
+		keyspace = self.keyspace
+	}
+	if keyspace == "" {
+		return table
+	}
+	return keyspace + "." + table
 }
 
 func (self *DataAccess) Delete(dao DAOLite) error {
-	return self.helper.Delete(dao.TableName(), self.Keys(dao)...)
+	da, span := self.startSpan("Delete", OpDelete, dao)
+	return span.endRow(da.deleteRow(dao))
 }
 
-// All column values filters (column/value pairs) for the provided DAO
+func (self *DataAccess) deleteRow(dao DAOLite) error {
+	if err := self.checkWrite(dao); err != nil {
+		return err
+	}
+	defer self.uncache(self.tableOf(dao), dao)
+	if info := self.denormalized(dao); info != nil {
+		return self.deleteDenormalized(dao, info, nil)
+	}
+	if err := self.beforeDelete(dao); err != nil {
+		return err
+	}
+	res := self.helperFor(dao).Delete(self.tableOf(dao), self.Keys(dao)...)
+	self.afterDelete(dao, res)
+	return res
+}
+
+// All column values filters (column/value pairs) for the provided DAO, nil if its
+// definition is invalid
 func (self *DataAccess) Fields(dao interface{}) []*F {
-	return self.fieldsOfKind(dao, ANY, []string{})
+	fields, _ := self.fieldsOfKind(dao, ANY, []string{})
+	return fields
 }
 
-// Primary keys values filters (column/value pairs) for the provided DAO
+// Primary keys values filters (column/value pairs) for the provided DAO, nil if its
+// definition is invalid
 func (self *DataAccess) Keys(dao interface{}) []*F {
-	return self.fieldsOfKind(dao, ANY_KEY, []string{})
+	fields, _ := self.fieldsOfKind(dao, ANY_KEY, []string{})
+	return fields
 }
 
-// Partition keys values filters (column/value pairs) for the provided DAO
+// Partition keys values filters (column/value pairs) for the provided DAO, nil if its
+// definition is invalid
 func (self *DataAccess) PartitionKeys(dao interface{}) []*F {
-	return self.fieldsOfKind(dao, PARTITION_KEY, []string{})
+	fields, _ := self.fieldsOfKind(dao, PARTITION_KEY, []string{})
+	return fields
 }
 
-func (self *DataAccess) fieldsOfKind(dao interface{}, filter colKind, names []string) []*F {
+func (self *DataAccess) fieldsOfKind(dao interface{}, filter colKind, names []string) ([]*F, error) {
+	if err := self.check(dao); err != nil {
+		return nil, err
+	}
 	def := self.initFieldsDefs(dao)
+	mapper := self.mapperFor(dao)
 	v := reflect.ValueOf(dao).Elem()
 	fields := make([]*F, 0, len(def))
 	for _, fdef := range def {
@@ -248,27 +589,64 @@ func (self *DataAccess) fieldsOfKind(dao interface{}, filter colKind, names []st
 			(fdef.kind >= PARTITION_KEY || fdef.kind == filter) || filter == fdef.kind {
 
 			if len(names) == 0 || StringInList(fdef.name, names) {
-				val := v.FieldByName(fdef.name)
-				switch val.Kind() {
-				case reflect.Int:
-					vali := val.Int()
-					fields = append(fields, &F{fdef.col, vali})
-				case reflect.Uint:
-					vali := val.Uint()
-					fields = append(fields, &F{fdef.col, vali})
-				case reflect.Float32:
-					valf := val.Float()
-					fields = append(fields, &F{fdef.col, valf})
-				case reflect.String:
-					vals := val.String()
-					fields = append(fields, &F{fdef.col, vals})
-				default:
-					fields = append(fields, &F{fdef.col, val.Interface()})
+				if mapper != nil {
+					fields = append(fields, &F{fdef.col, mapper.Value(dao, fdef.name)})
+				} else {
+					fields = append(fields, &F{fdef.col, self.bind(v.FieldByName(fdef.name))})
 				}
 			}
 		}
 	}
-	return fields
+	return fields, nil
+}
+
+var (
+	durationType  = reflect.TypeOf(time.Duration(0))
+	marshalerType = reflect.TypeOf((*gocql.Marshaler)(nil)).Elem()
+)
+
+// Converts a field value to the value bound in statements. Values of numeric, boolean and
+// string kinds, named types included, are bound as the basic type of the same size, so
+// marshalling doesn't depend on gocql handling named types. int and uint are bound as 64
+// bits integers.
+func bindValue(val reflect.Value) interface{} {
+	if val.Type() == durationType || val.Type().Implements(marshalerType) ||
+		reflect.PointerTo(val.Type()).Implements(marshalerType) {
+		return val.Interface()
+	}
+	switch val.Kind() {
+	case reflect.Int, reflect.Int64:
+		return val.Int()
+	case reflect.Int32:
+		return int32(val.Int())
+	case reflect.Int16:
+		return int16(val.Int())
+	case reflect.Int8:
+		return int8(val.Int())
+	case reflect.Uint, reflect.Uint64:
+		return val.Uint()
+	case reflect.Uint32:
+		return uint32(val.Uint())
+	case reflect.Uint16:
+		return uint16(val.Uint())
+	case reflect.Uint8:
+		return uint8(val.Uint())
+	case reflect.Float32:
+		return float32(val.Float())
+	case reflect.Float64:
+		return val.Float()
+	case reflect.Bool:
+		return val.Bool()
+	case reflect.String:
+		return val.String()
+	default:
+		return val.Interface()
+	}
+}
+
+// Same conversion of field values as DataAccess, for generated mappers.
+func BindValue(v interface{}) interface{} {
+	return bindValue(reflect.ValueOf(v))
 }
 
 func (self *DataAccess) FieldNamesOfKind(dao interface{}, filter colKind) []string {
@@ -297,49 +675,179 @@ func (self *DataAccess) namesOfKind(dao interface{}, colNotName bool, filter col
 	return names
 }
 
+// Validates the definition of the provided DAOs and registers them, so that invalid DAOs
+// are caught at startup rather than when first used. Operations on DAOs with an invalid
+// definition return the same error. Use Registry to register a DAO type with options.
+// Example:
+//
+//	if err := da.Register(&User{}, &Address{}); err != nil {
+//		log.Fatal(err)
+//	}
+func (self *DataAccess) Register(daos ...DAOLite) error {
+	for _, dao := range daos {
+		if _, err := self.registry.Register(dao); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Registry holding the metadata of the DAO types used.
+func (self *DataAccess) Registry() *Registry {
+	return self.registry
+}
+
+// Field definitions of the DAO, nil when its definition is invalid.
 func (self *DataAccess) initFieldsDefs(dao interface{}) []*fieldDef {
-	// This reliably gets the name of the object
-	tname := reflect.TypeOf(dao).String()
-	self.defMutex.RLock()
-	def := self.fieldDefsCache[tname]
-	self.defMutex.RUnlock()
-	if def == nil {
-		def = fieldDefs(dao)
-		self.defMutex.Lock()
-		self.fieldDefsCache[tname] = def
-		self.defMutex.Unlock()
-	}
-	return def
-}
-
-func fieldDefs(dao interface{}) []*fieldDef {
-	t := reflect.TypeOf(dao).Elem()
+	info, err := self.registry.Lookup(dao)
+	if err != nil {
+		return nil
+	}
+	return info.defs
+}
+
+// Error of an invalid DAO definition, if any. Operations call it first.
+func (self *DataAccess) check(dao interface{}) error {
+	_, err := self.registry.Lookup(dao)
+	return err
+}
+
+// Invalid definition of a DAO type, found when registering it or first using it
+type DefinitionError struct {
+	Type  reflect.Type
+	Field string // empty when not specific to a field
+	Msg   string
+}
+
+func (self *DefinitionError) Error() string {
+	msg := "dago: invalid DAO " + self.Type.String() + ": "
+	if self.Field != "" {
+		msg += "field " + self.Field + ": "
+	}
+	return msg + self.Msg
+}
+
+// Field definitions of a DAO, checking that they're usable.
+func daoFieldDefs(dao interface{}) ([]*fieldDef, error) {
+	t := reflect.TypeOf(dao)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil, &DefinitionError{t, "", "must be a pointer to a struct"}
+	}
+	defs, err := fieldDefs(t.Elem())
+	if err != nil {
+		err.(*DefinitionError).Type = t
+		return nil, err
+	}
+
+	cols := make(map[string]bool, len(defs))
+	hasKey := false
+	for _, fdef := range defs {
+		if cols[fdef.col] {
+			return nil, &DefinitionError{t, fdef.name, "duplicate column " + strconv.Quote(fdef.col)}
+		}
+		cols[fdef.col] = true
+		hasKey = hasKey || fdef.kind == PARTITION_KEY
+	}
+	if !hasKey {
+		return nil, &DefinitionError{t, "", "no partition key, tag at least one field with the key qualifier"}
+	}
+	return defs, nil
+}
+
+// Qualifiers accepted after the column name in tags, for tools checking or generating code
+// for DAOs, like dagogen and the tagcheck analyzer.
+func TagQualifiers() []string {
+	qualifiers := []string{"key", "sort", "redact", "omitempty", "traverse"}
+	indexes := make([]string, 0, len(indexClasses))
+	for qualifier := range indexClasses {
+		indexes = append(indexes, qualifier)
+	}
+	sort.Strings(indexes)
+	return append(qualifiers, indexes...)
+}
+
+// Tells why column tag qualifiers can't be used together, empty when they can. Shared with
+// the tagcheck analyzer.
+func QualifierConflict(qualifiers []string) string {
+	key, omitEmpty := false, false
+	for _, qualifier := range qualifiers {
+		switch qualifier {
+		case "key", "sort":
+			key = true
+		case "omitempty":
+			omitEmpty = true
+		}
+	}
+	if key && omitEmpty {
+		return "key fields can't be omitempty"
+	}
+	return ""
+}
+
+func fieldDefs(t reflect.Type) ([]*fieldDef, error) {
 	fDefs := make([]*fieldDef, 0, t.NumField())
 	for n := 0; n < t.NumField(); n++ {
 		sf := t.Field(n)
-		colspec := strings.Split(sf.Tag.Get("column"), ",")
+		if sf.PkgPath != "" && !sf.Anonymous {
+			// unexported, can't be read nor set
+			continue
+		}
+		tag, tagged := sf.Tag.Lookup("column")
+		if !tagged {
+			if sf.Anonymous {
+				continue
+			}
+			return nil, &DefinitionError{t, sf.Name, "no column tag, unexport the field if it isn't persisted"}
+		}
+		colspec := strings.Split(tag, ",")
 		colkind := NON_KEY
-		if len(colspec) > 1 {
-			switch colspec[1] {
+		redact, omitEmpty, traverse, skip := false, false, false, false
+		index := ""
+		for _, qualifier := range colspec[1:] {
+			if !StringInList(qualifier, TagQualifiers()) {
+				if !sf.Anonymous {
+					return nil, &DefinitionError{t, sf.Name, "bad column tag qualifier " + strconv.Quote(qualifier)}
+				}
+				skip = true
+				continue
+			}
+			if class, ok := indexClasses[qualifier]; ok {
+				index = class
+				continue
+			}
+			switch qualifier {
 			case "key":
 				colkind = PARTITION_KEY
 			case "sort":
 				colkind = CLUSTERING_KEY
+			case "redact":
+				redact = true
+			case "omitempty":
+				omitEmpty = true
 			case "traverse":
-				sfval := reflect.ValueOf(dao).Elem().Field(n)
-				fDefs = append(fDefs, fieldDefs(sfval.Interface())...)
-				continue
-			default:
-				if sf.Anonymous {
-					continue
-				} else {
-					panic("Bad column tag qualifier: " + colspec[1])
-				}
+				traverse = true
+			}
+		}
+		if skip {
+			continue
+		}
+		if conflict := QualifierConflict(colspec[1:]); conflict != "" {
+			return nil, &DefinitionError{t, sf.Name, conflict}
+		}
+		if traverse {
+			if !sf.Anonymous || sf.Type.Kind() != reflect.Ptr || sf.Type.Elem().Kind() != reflect.Struct {
+				return nil, &DefinitionError{t, sf.Name, "traversed field must be an embedded pointer to a struct"}
+			}
+			inner, err := fieldDefs(sf.Type.Elem())
+			if err != nil {
+				return nil, err
 			}
+			fDefs = append(fDefs, inner...)
+			continue
 		}
-		fDefs = append(fDefs, &fieldDef{n, sf.Name, colspec[0], colkind})
+		fDefs = append(fDefs, &fieldDef{n, sf.Name, colspec[0], colkind, redact, omitEmpty, index})
 	}
-	return fDefs
+	return fDefs, nil
 }
 
 // Get rid of this when it's part of the standard library with generics
@@ -2,9 +2,11 @@ package dago
 
 import (
 	"math/big"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/gocql/gocql"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -30,3 +32,210 @@ func TestReflect(t *testing.T) {
 	assert.Equal(t, da.ColNamesOfKind(simple, ANY), []string{"astring", "some_bytes", "abigint", "anint", "some_date_time", "avarint", "abool"})
 	assert.Equal(t, da.Keys(simple), []*F{&F{"astring", "foo"}, &F{"some_bytes", []byte{42, 101}}, &F{"abigint", uint64(123)}, &F{"anint", int64(11)}})
 }
+
+type RedactedDao struct {
+	Country string `column:"country,key"`
+	SSN     string `column:"ssn,sort,redact"`
+	Name    string `column:"name"`
+}
+
+func (self *RedactedDao) TableName() string {
+	return "redacted_dao"
+}
+
+func TestRedact(t *testing.T) {
+	da := NewDataAccess(NewCQLHelper(nil))
+	dao := &RedactedDao{"US", "890-123-4567", "Joe"}
+	assert.Equal(t, da.ColNamesOfKind(dao, CLUSTERING_KEY), []string{"ssn"})
+
+	helper := da.helperFor(dao)
+	st := &Statement{Columns: []string{"country", "ssn", "name"}, Values: []interface{}{"US", "890-123-4567", "Joe"},
+		CQL: "insert into redacted_dao (country,ssn,name) values (?, ?, ?)", redacted: helper.redacted}
+	assert.Equal(t, st.SafeValues(), []interface{}{"US", "<redacted>", "Joe"})
+	assert.NotContains(t, st.String(), "890")
+}
+
+type BadQualifierDao struct {
+	Country string `column:"country,primary"`
+}
+
+func (self *BadQualifierDao) TableName() string {
+	return "bad_dao"
+}
+
+type NoKeyDao struct {
+	Country string `column:"country"`
+}
+
+func (self *NoKeyDao) TableName() string {
+	return "no_key_dao"
+}
+
+type UntaggedDao struct {
+	Country string `column:"country,key"`
+	Notes   string
+}
+
+func (self *UntaggedDao) TableName() string {
+	return "untagged_dao"
+}
+
+func TestRegister(t *testing.T) {
+	da := NewDataAccess(NewCQLHelper(nil))
+	assert.NoError(t, da.Register(&SimpleDao{}, &RedactedDao{}))
+
+	err := da.Register(&BadQualifierDao{})
+	assert.EqualError(t, err, `dago: invalid DAO *dago.BadQualifierDao: field Country: bad column tag qualifier "primary"`)
+	// operations fail the same way instead of panicking
+	assert.Equal(t, err, da.Save(&BadQualifierDao{}))
+	assert.Equal(t, err, da.PartitionIter(&BadQualifierDao{}).Close())
+	assert.Empty(t, da.Keys(&BadQualifierDao{}))
+
+	assert.EqualError(t, da.Delete(&NoKeyDao{}),
+		"dago: invalid DAO *dago.NoKeyDao: no partition key, tag at least one field with the key qualifier")
+
+	// like the tagcheck analyzer reports
+	assert.EqualError(t, da.Register(&UntaggedDao{}),
+		"dago: invalid DAO *dago.UntaggedDao: field Notes: no column tag, unexport the field if it isn't persisted")
+
+	// qualifiers listed for tools are the ones accepted
+	for _, qualifier := range TagQualifiers() {
+		if qualifier == "traverse" {
+			continue
+		}
+		_, err := fieldDefs(reflect.StructOf([]reflect.StructField{
+			{Name: "Value", Type: reflect.TypeOf(""), Tag: reflect.StructTag(`column:"value,` + qualifier + `"`)},
+		}))
+		assert.NoError(t, err, qualifier)
+	}
+}
+
+func TestIn(t *testing.T) {
+	da := NewDataAccess(NewCQLHelper(nil))
+	assert.Equal(t, "simple_dao", da.tableOf(&SimpleDao{}))
+
+	testnet := da.In("testnet3")
+	assert.Equal(t, "testnet3.simple_dao", testnet.tableOf(&SimpleDao{}))
+	assert.Equal(t, "testnet3.other", testnet.qualify("other", ""))
+	assert.Equal(t, "main.other", testnet.qualify("main.other", ""))
+
+	mapped := testnet.MapTables(map[string]string{"simple_dao": "simple_2017"})
+	assert.Equal(t, "testnet3.simple_2017", mapped.tableOf(&SimpleDao{}))
+	// the original is left untouched
+	assert.Equal(t, "testnet3.simple_dao", testnet.tableOf(&SimpleDao{}))
+}
+
+func TestSaveTable(t *testing.T) {
+	rec, da := newRecorder(nil)
+	mapped := da.MapTables(map[string]string{"simple_dao": "simple_2017", "simple_2017": "simple_old"})
+	dao := &SimpleDao{AString: "foo", SomeBytes: []byte{1}}
+	assert.NoError(t, mapped.Save(dao))
+	assert.NoError(t, mapped.SaveTable("simple_dao", dao))
+	assert.Len(t, rec.statements, 2)
+	// mappings apply once
+	for _, cql := range rec.CQL() {
+		assert.Contains(t, cql, "insert into simple_2017 ")
+	}
+}
+
+func TestSetRetryPolicy(t *testing.T) {
+	da := NewDataAccess(NewCQLHelper(nil))
+	testnet := da.In("testnet3")
+	policy := NewExponentialRetryPolicy(3, time.Millisecond, time.Second)
+	testnet.SetRetryPolicy(policy)
+	assert.Equal(t, policy, testnet.helperFor(&SimpleDao{}).retry)
+	// the original isn't changed
+	assert.Nil(t, da.helperFor(&SimpleDao{}).retry)
+	assert.Same(t, da.helper, testnet.helper)
+
+	// interceptors added afterwards still apply
+	db := Wrap(&gocql.Session{})
+	mainnet := db.GetDA().In("bitcoin")
+	mainnet.SetRetryPolicy(policy)
+	tracer, rec := &fakeTracer{}, &recorder{}
+	db.Instrument(tracer, newFakeMetrics())
+	db.Use(rec.intercept)
+	assert.NoError(t, mainnet.Save(&SimpleDao{AString: "foo", SomeBytes: []byte{1}}))
+	assert.Len(t, rec.statements, 1)
+	assert.Len(t, tracer.named("dago.Save bitcoin.simple_dao"), 1)
+}
+
+// DAO passed by value by mistake
+type ValDao struct {
+	Key   string `column:"key,key"`
+	Value string `column:"value"`
+}
+
+func (self ValDao) TableName() string {
+	return "val_dao"
+}
+
+func TestNonPointerDAO(t *testing.T) {
+	rec, da := newRecorder(nil)
+	dao := ValDao{Key: "a"}
+	msg := "dago: invalid DAO dago.ValDao: must be a pointer to a struct"
+	errs := map[string]error{}
+	_, errs["Get"] = da.Get(dao)
+	_, errs["cached Get"] = da.WithCache(NewLRUCache(10)).Get(dao)
+	_, errs["GetBy"] = da.GetBy(nil, dao)
+	_, errs["GetJSON"] = da.GetJSON(dao)
+	_, errs["GetMany"] = da.GetMany([]DAOLite{dao, dao})
+	errs["Save"] = da.Save(dao)
+	errs["SaveTable"] = da.SaveTable("val_dao", dao)
+	errs["SaveIfNotExists"] = da.SaveIfNotExists(dao)
+	errs["SavePartial"] = da.SavePartial(dao, "Value")
+	errs["SaveJSON"] = da.SaveJSON(dao, []byte(`{"key": "a"}`))
+	errs["Delete"] = da.Delete(dao)
+	errs["DeleteFields"] = da.DeleteFields(dao, "Value")
+	errs["DeletePartition"] = da.DeletePartition(dao)
+	errs["DeleteRange"] = da.DeleteRange(dao, Gt("Value", 1))
+	_, errs["CountRows"] = da.CountRows(dao)
+	_, errs["CopyTable"] = da.CopyTable(&CopyJob{Source: dao})
+	_, errs["Rollback"] = da.Rollback(1, []DAOLite{dao}, true)
+	errs["PartitionIter"] = da.PartitionIter(dao).Close()
+	errs["PartitionIterRange"] = da.PartitionIterRange(dao).Close()
+	errs["PartitionIterLimit"] = da.PartitionIterLimit(dao, 1).Close()
+	errs["FullIter"] = da.FullIter(dao).Close()
+	errs["FindBy"] = da.FindBy(dao, "Value", "b").Close()
+	for op, err := range errs {
+		assert.EqualError(t, err, msg, op)
+	}
+	assert.Nil(t, da.Keys(dao))
+	assert.Nil(t, da.PartitionKeys(dao))
+	assert.Nil(t, da.Fields(dao))
+	assert.Empty(t, rec.statements)
+}
+
+type Height int32
+type Satoshis uint64
+type Ratio float32
+
+func TestBindValue(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		bound interface{}
+	}{
+		{int(-1), int64(-1)},
+		{int8(-1), int8(-1)},
+		{int16(300), int16(300)},
+		{int32(70000), int32(70000)},
+		{int64(1 << 40), int64(1 << 40)},
+		{uint(1), uint64(1)},
+		{uint8(255), uint8(255)},
+		{uint16(1), uint16(1)},
+		{uint32(1), uint32(1)},
+		{uint64(1), uint64(1)},
+		{float32(0.1), float32(0.1)},
+		{float64(0.1), float64(0.1)},
+		{Height(500000), int32(500000)},
+		{Satoshis(42), uint64(42)},
+		{Ratio(0.5), float32(0.5)},
+		{true, true},
+		{time.Second, time.Second},
+		{NullOf(1), NullOf(1)},
+		{[]byte{1}, []byte{1}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.bound, BindValue(test.value), "%T", test.value)
+	}
+}
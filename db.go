@@ -10,9 +10,24 @@ type CassandraDb struct {
 	da      *DataAccess
 }
 
+// Optional settings applied when creating a CassandraDb, see WithLogger.
+type Option func(*CassandraDb)
+
+// Adds interceptors to the chain of the CassandraDb, see Use.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(db *CassandraDb) {
+		db.Use(interceptors...)
+	}
+}
+
 // Convenience method to initiate a session and return a CassandraDb
 // with a default cluster configuration.
 func Open(keyspace string, hosts ...string) (*CassandraDb, error) {
+	return OpenWithOptions(keyspace, hosts)
+}
+
+// Same as Open, applying the provided options.
+func OpenWithOptions(keyspace string, hosts []string, opts ...Option) (*CassandraDb, error) {
 	cluster := gocql.NewCluster(hosts...)
 	cluster.Keyspace = keyspace
 
@@ -21,15 +36,20 @@ func Open(keyspace string, hosts ...string) (*CassandraDb, error) {
 		return nil, err
 	}
 
-	return Wrap(session), nil
+	store := Wrap(session, opts...)
+	store.helper.keyspace = keyspace
+	return store, nil
 }
 
 // Wraps an existing gocql session into a CassandraDb to gain access
 // to our CQL helper and Data Access object
-func Wrap(session *gocql.Session) *CassandraDb {
+func Wrap(session *gocql.Session, opts ...Option) *CassandraDb {
 	helper := NewCQLHelper(session)
 	da := NewDataAccess(helper)
 	store := &CassandraDb{session, helper, da}
+	for _, opt := range opts {
+		opt(store)
+	}
 	return store
 }
 
@@ -45,6 +65,12 @@ func (self *CassandraDb) GetHelper() *CQLHelper {
 	return self.helper
 }
 
+// Adds interceptors called around every statement executed by the CQL helper, including
+// those issued by the DataAccess. Must be called before the CassandraDb is used.
+func (self *CassandraDb) Use(interceptors ...Interceptor) {
+	self.helper.Use(interceptors...)
+}
+
 // Return the gocql Session reference
 func (self *CassandraDb) GetSession() *gocql.Session {
 	return self.session
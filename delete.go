@@ -0,0 +1,143 @@
+package dago
+
+import (
+	"errors"
+	"reflect"
+)
+
+// Deletes all rows of the partition of the provided DAO, which is expected to have values
+// for its partition keys. Delete hooks are called on the provided DAO only. Refused for DAOs
+// with secondary tables, whose rows can't be found from the partition.
+// Example:
+//
+//	err := da.DeletePartition(&Output{Address: addr})
+func (self *DataAccess) DeletePartition(dao DAOLite) error {
+	da, span := self.startSpan("DeletePartition", OpDelete, dao)
+	return span.end(da.deletePartition(dao), -1)
+}
+
+func (self *DataAccess) deletePartition(dao DAOLite) error {
+	if err := self.check(dao); err != nil {
+		return err
+	}
+	if self.denormalized(dao) != nil {
+		return errSecondaryRange
+	}
+	defer self.uncacheRange(self.tableOf(dao), dao, self.PartitionKeys(dao))
+	return self.deleteWhere(dao, nil, self.PartitionKeys(dao), nil)
+}
+
+// Deletes the rows of the partition of the provided DAO within the bounds, named after the
+// DAO clustering key fields, using a single range tombstone. Delete hooks are called on the
+// provided DAO only. Refused for DAOs with secondary tables, like DeletePartition.
+// Example:
+//
+//	// all outputs of the address above the fork height
+//	err := da.DeleteRange(&Output{Address: addr}, dago.Gt("Height", forkHeight))
+func (self *DataAccess) DeleteRange(dao DAOLite, bounds ...*Bound) error {
+	da, span := self.startSpan("DeleteRange", OpDelete, dao)
+	return span.end(da.deleteRange(dao, bounds...), -1)
+}
+
+func (self *DataAccess) deleteRange(dao DAOLite, bounds ...*Bound) error {
+	if err := self.check(dao); err != nil {
+		return err
+	}
+	if len(bounds) == 0 {
+		return errors.New("dago: no bound for range delete, use DeletePartition")
+	}
+	if self.denormalized(dao) != nil {
+		return errSecondaryRange
+	}
+	colBounds, err := self.colBounds(dao, bounds)
+	if err != nil {
+		return err
+	}
+	defer self.uncacheRange(self.tableOf(dao), dao, self.PartitionKeys(dao))
+	return self.deleteWhere(dao, nil, self.PartitionKeys(dao), colBounds)
+}
+
+// Deletes the values of the provided non key fields from the row of the DAO, leaving the
+// rest of the row as is, in secondary tables too. Delete hooks are called.
+// Example:
+//
+//	err := da.DeleteFields(&User{Country: "US", SSN: "890-123-4567"}, "Email", "Phone")
+func (self *DataAccess) DeleteFields(dao DAOLite, fields ...string) error {
+	da, span := self.startSpan("DeleteFields", OpDelete, dao)
+	return span.endRow(da.deleteFields(dao, fields...))
+}
+
+func (self *DataAccess) deleteFields(dao DAOLite, fields ...string) error {
+	if err := self.check(dao); err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		return errors.New("dago: no field to delete")
+	}
+	cols := make([]string, len(fields))
+	for n, field := range fields {
+		fdef := self.fieldDef(dao, field)
+		if fdef == nil || fdef.kind != NON_KEY {
+			return errors.New("dago: cannot delete " + field + ", not a non key field")
+		}
+		cols[n] = fdef.col
+	}
+	defer self.uncache(self.tableOf(dao), dao)
+	if info := self.denormalized(dao); info != nil {
+		if err := self.checkWrite(dao); err != nil {
+			return err
+		}
+		for _, m := range info.Secondary {
+			for _, field := range fields {
+				if StringInList(field, m.PartitionKeys) || StringInList(field, m.ClusteringKeys) {
+					return errors.New("dago: cannot delete " + field + ", key of secondary table " + m.Table)
+				}
+			}
+		}
+		return self.deleteDenormalized(dao, info, cols)
+	}
+	return self.deleteWhere(dao, cols, self.Keys(dao), nil)
+}
+
+// Same bounds on the columns of the clustering key fields they name.
+func (self *DataAccess) colBounds(dao DAOLite, bounds []*Bound) ([]*Bound, error) {
+	colBounds := make([]*Bound, len(bounds))
+	for n, bound := range bounds {
+		fdef := self.fieldDef(dao, bound.Name)
+		if fdef == nil || fdef.kind != CLUSTERING_KEY {
+			return nil, errors.New("dago: range bound on " + bound.Name + ", not a clustering key field")
+		}
+		switch bound.Op {
+		case "=", "<", "<=", ">", ">=":
+		default:
+			return nil, errors.New("dago: bad range bound operator " + bound.Op)
+		}
+		if bound.Value == nil {
+			return nil, errors.New("dago: nil range bound value on " + bound.Name)
+		}
+		colBounds[n] = &Bound{fdef.col, bound.Op, self.bind(reflect.ValueOf(bound.Value))}
+	}
+	return colBounds, nil
+}
+
+func (self *DataAccess) deleteWhere(dao DAOLite, cols []string, keys []*F, bounds []*Bound) error {
+	if err := self.checkWrite(dao); err != nil {
+		return err
+	}
+	if err := self.beforeDelete(dao); err != nil {
+		return err
+	}
+	res := self.helperFor(dao).DeleteWhere(self.tableOf(dao), cols, keys, bounds...)
+	self.afterDelete(dao, res)
+	return res
+}
+
+// Definition of the named field of the DAO, nil if not persisted.
+func (self *DataAccess) fieldDef(dao interface{}, name string) *fieldDef {
+	for _, fdef := range self.initFieldsDefs(dao) {
+		if fdef.name == name {
+			return fdef
+		}
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package dago
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteValidation(t *testing.T) {
+	da := NewDataAccess(NewCQLHelper(nil))
+	simple := &SimpleDao{AString: "foo"}
+	assert.EqualError(t, da.DeleteRange(simple), "dago: no bound for range delete, use DeletePartition")
+	assert.EqualError(t, da.DeleteRange(simple, Gt("AString", "a")),
+		"dago: range bound on AString, not a clustering key field")
+	assert.EqualError(t, da.DeleteRange(simple, &Bound{"AnInt", "!=", 1}), "dago: bad range bound operator !=")
+	assert.EqualError(t, da.DeleteFields(simple, "ABool", "AnInt"), "dago: cannot delete AnInt, not a non key field")
+	assert.EqualError(t, da.DeleteFields(simple), "dago: no field to delete")
+}
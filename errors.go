@@ -0,0 +1,111 @@
+package dago
+
+import (
+	"errors"
+
+	"github.com/gocql/gocql"
+)
+
+var (
+	// Returned when a row being fetched doesn't exist. Same as gocql's.
+	ErrNotFound = gocql.ErrNotFound
+	// A coordinator or replicas didn't answer in time. The write may still have been applied.
+	ErrTimeout = errors.New("dago: timeout")
+	// Not enough replicas or no connection available to serve the request.
+	ErrUnavailable = errors.New("dago: unavailable")
+	// The coordinator was too busy to handle the request.
+	ErrOverloaded = errors.New("dago: overloaded")
+	// The condition of a lightweight transaction (IF or IF NOT EXISTS) didn't hold.
+	ErrLWTNotApplied = errors.New("dago: lightweight transaction not applied")
+)
+
+// Wraps an error returned by gocql with the dago sentinel classifying it. Both the sentinel
+// and the original error can be checked with errors.Is and errors.As.
+type classifiedError struct {
+	kind error
+	err  error
+}
+
+func (self *classifiedError) Error() string {
+	return self.kind.Error() + ": " + self.err.Error()
+}
+
+func (self *classifiedError) Is(target error) bool {
+	return target == self.kind
+}
+
+func (self *classifiedError) Unwrap() error {
+	return self.err
+}
+
+// Wraps the provided error when it's recognized as one of the dago error kinds, returns it
+// unchanged otherwise.
+func classify(err error) error {
+	if err == nil || err == gocql.ErrNotFound {
+		return err
+	}
+	var ce *classifiedError
+	if errors.As(err, &ce) {
+		return err
+	}
+	if kind := errorKind(err); kind != nil {
+		return &classifiedError{kind, err}
+	}
+	return err
+}
+
+func errorKind(err error) error {
+	switch err {
+	case gocql.ErrTimeoutNoResponse:
+		return ErrTimeout
+	case gocql.ErrNoConnections, gocql.ErrConnectionClosed, gocql.ErrUnavailable:
+		return ErrUnavailable
+	}
+	var reqErr gocql.RequestError
+	if errors.As(err, &reqErr) {
+		switch reqErr.Code() {
+		case gocql.ErrCodeWriteTimeout, gocql.ErrCodeReadTimeout:
+			return ErrTimeout
+		case gocql.ErrCodeUnavailable, gocql.ErrCodeBootstrapping:
+			return ErrUnavailable
+		case gocql.ErrCodeOverloaded:
+			return ErrOverloaded
+		}
+	}
+	return nil
+}
+
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+func IsTimeout(err error) bool {
+	return errors.Is(classify(err), ErrTimeout)
+}
+
+func IsUnavailable(err error) bool {
+	return errors.Is(classify(err), ErrUnavailable)
+}
+
+func IsOverloaded(err error) bool {
+	return errors.Is(classify(err), ErrOverloaded)
+}
+
+func IsLWTNotApplied(err error) bool {
+	return errors.Is(err, ErrLWTNotApplied)
+}
+
+// Tells whether an operation failing with the provided error may succeed when tried again,
+// provided it's idempotent.
+func IsRetryable(err error) bool {
+	return IsTimeout(err) || IsUnavailable(err) || IsOverloaded(err)
+}
+
+// Utility function to eliminate not found errors
+func ENF(err error) error {
+	if IsNotFound(err) {
+		return nil
+	} else {
+		return err
+	}
+}
@@ -0,0 +1,37 @@
+package dago
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+type requestErr int
+
+func (self requestErr) Code() int       { return int(self) }
+func (self requestErr) Message() string { return "request error" }
+func (self requestErr) Error() string   { return self.Message() }
+
+func TestClassify(t *testing.T) {
+	wto := requestErr(gocql.ErrCodeWriteTimeout)
+	err := classify(wto)
+	assert.True(t, errors.Is(err, ErrTimeout))
+	assert.True(t, IsTimeout(wto))
+	assert.True(t, IsRetryable(err))
+	var target requestErr
+	assert.True(t, errors.As(err, &target))
+	assert.True(t, IsOverloaded(requestErr(gocql.ErrCodeOverloaded)))
+
+	assert.True(t, IsUnavailable(gocql.ErrNoConnections))
+	assert.False(t, IsOverloaded(gocql.ErrNoConnections))
+	assert.True(t, IsUnavailable(gocql.ErrConnectionClosed))
+	assert.False(t, IsTimeout(gocql.ErrConnectionClosed))
+	assert.Equal(t, gocql.ErrNotFound, classify(gocql.ErrNotFound))
+	assert.Nil(t, ENF(ErrNotFound))
+
+	other := errors.New("syntax error")
+	assert.Equal(t, other, classify(other))
+	assert.False(t, IsRetryable(other))
+}
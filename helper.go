@@ -1,8 +1,12 @@
 package dago
 
 import (
+	"context"
+	"reflect"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/gocql/gocql"
 )
@@ -13,153 +17,409 @@ type F struct {
 }
 
 type CQLHelper struct {
-	db *gocql.Session
+	db           *gocql.Session
+	retry        gocql.RetryPolicy
+	ctx          context.Context
+	interceptors []Interceptor
+	daoType      reflect.Type
+	redacted     map[string]bool
+	ttl          time.Duration
+	consistency  *gocql.Consistency
+	// tracer of DataAccess operations, see CassandraDb.Instrument
+	tracer Tracer
+	// keyspace of the session, when known
+	keyspace string
 }
 
 func NewCQLHelper(db *gocql.Session) *CQLHelper {
 	return &CQLHelper{db: db}
 }
 
+// Sets the retry policy applied to all idempotent statements created by the helper. Non
+// idempotent ones, like lightweight transactions, are never retried when a policy is set.
+func (self *CQLHelper) SetRetryPolicy(policy gocql.RetryPolicy) {
+	self.retry = policy
+}
+
+// Returns a copy of the helper running all its queries with the provided context.
+func (self *CQLHelper) withContext(ctx context.Context) *CQLHelper {
+	helper := *self
+	helper.ctx = ctx
+	return &helper
+}
+
+// Returns a copy of the helper issuing statements on behalf of the DAO type, values of its
+// redacted columns being masked when rendering statements, and its TTL and consistency
+// applied.
+func (self *CQLHelper) forDAO(info *DAOInfo) *CQLHelper {
+	helper := *self
+	helper.daoType = info.Type
+	helper.redacted = info.redacted
+	helper.ttl = info.TTL
+	helper.consistency = info.Consistency
+	return &helper
+}
+
+// Creates the statement and its query binding the provided fields values in order, all
+// helper queries go through here.
+func (self *CQLHelper) statement(op Op, table string, stmt string, idempotent bool, fields ...*F) *Statement {
+	cols := make([]string, len(fields))
+	values := make([]interface{}, len(fields))
+	for n, field := range fields {
+		cols[n] = field.Name
+		values[n] = field.Value
+	}
+	q := self.db.Query(stmt, values...).Idempotent(idempotent)
+	if self.ctx != nil {
+		q = q.WithContext(self.ctx)
+	}
+	if self.retry != nil {
+		if idempotent {
+			q.RetryPolicy(self.retry)
+		} else {
+			q.RetryPolicy(nil)
+		}
+	}
+	return &Statement{op, table, stmt, cols, values, idempotent, self.daoType, q, nil, nil, self.redacted, self.db}
+}
+
+// Groups the statements in a logged batch, so that either all or none of them apply
+// eventually.
+func (self *CQLHelper) batch(table string, stmts ...*Statement) *Statement {
+	b := self.db.NewBatch(gocql.LoggedBatch)
+	idempotent := true
+	st := &Statement{Op: OpBatch, Table: table, DAOType: self.daoType, Batch: b, Statements: stmts,
+		redacted: self.redacted, session: self.db}
+	cql := make([]string, len(stmts))
+	for n, entry := range stmts {
+		b.Query(entry.CQL, entry.Values...)
+		cql[n] = entry.CQL
+		st.Columns = append(st.Columns, entry.Columns...)
+		st.Values = append(st.Values, entry.Values...)
+		idempotent = idempotent && entry.Idempotent
+	}
+	st.CQL = "begin batch " + strings.Join(cql, "; ") + "; apply batch"
+	st.Idempotent = idempotent
+	if self.retry != nil && idempotent {
+		b.RetryPolicy(self.retry)
+	}
+	b.SetConsistency(gocql.LocalQuorum)
+	return st
+}
+
+// Runs a statement not returning rows.
+func (self *CQLHelper) exec(st *Statement) error {
+	return classify(self.run(st).Close())
+}
+
+// Runs a lightweight transaction statement, returning ErrLWTNotApplied when its condition
+// didn't hold.
+func (self *CQLHelper) execCAS(st *Statement) error {
+	st.Query.NoSkipMetadata()
+	iter := self.run(st)
+	row := make(map[string]interface{})
+	found := false
+	if ms, ok := iter.(MapScanner); ok {
+		found = ms.MapScan(row)
+	}
+	if err := iter.Close(); err != nil {
+		return classify(err)
+	}
+	if applied, ok := row["[applied]"].(bool); found && ok && !applied {
+		return ErrLWTNotApplied
+	}
+	return nil
+}
+
 func (self *CQLHelper) Get(table string, pk *F, fields ...string) *gocql.Query {
-	q := "select " + strings.Join(fields, ", ") + " from " + table + " where " + pk.Name + "=?"
-	return self.db.Query(q, pk.Value)
+	return self.getN(table, []*F{pk}, "", fields).Query
 }
 
 func (self *CQLHelper) Get2(table string, pk1 *F, pk2 *F, fields ...string) *gocql.Query {
-	q := "select " + strings.Join(fields, ", ") + " from " + table +
-		" where " + pk1.Name + "=? and " + pk2.Name + "=?"
-	return self.db.Query(q, pk1.Value, pk2.Value)
+	return self.getN(table, []*F{pk1, pk2}, "", fields).Query
 }
 
 func (self *CQLHelper) Get3(table string, pk1 *F, pk2 *F, pk3 *F, fields ...string) *gocql.Query {
-	q := "select " + strings.Join(fields, ", ") + " from " + table +
-		" where " + pk1.Name + "=? and " + pk2.Name + "=? and " + pk3.Name + "=?"
-	return self.db.Query(q, pk1.Value, pk2.Value, pk3.Value)
+	return self.getN(table, []*F{pk1, pk2, pk3}, "", fields).Query
 }
 
 func (self *CQLHelper) GetN(table string, pks []*F, fields ...string) *gocql.Query {
-	keys, values := self.andKeysAndValues(pks...)
-	q := "select " + strings.Join(fields, ", ") + " from " + table + " where " + keys
-	return self.db.Query(q, values...)
+	return self.getN(table, pks, "", fields).Query
+}
+
+// Select statement filtering on the provided keys, the suffix being appended as is.
+func (self *CQLHelper) getN(table string, pks []*F, suffix string, fields []string) *Statement {
+	keys, _ := self.andKeysAndValues(pks...)
+	q := "select " + joinColumns(fields) + " from " + table + " where " + keys + suffix
+	return self.statement(OpSelect, table, q, true, pks...)
+}
+
+// Same as GetN but matches the in column against any of the provided values.
+func (self *CQLHelper) GetNIn(table string, pks []*F, in string, inValues []interface{}, fields ...string) *gocql.Query {
+	return self.getNIn(table, pks, in, inValues, fields).Query
+}
+
+func (self *CQLHelper) getNIn(table string, pks []*F, in string, inValues []interface{}, fields []string) *Statement {
+	keys, _ := self.andKeysAndValues(pks...)
+	q := "select " + joinColumns(fields) + " from " + table + " where "
+	if len(pks) > 0 {
+		q += keys + " and "
+	}
+	q += quoteColumn(in) + " in ?"
+	return self.statement(OpSelect, table, q, true, append(pks[:len(pks):len(pks)], &F{in, inValues})...)
 }
 
 func (self *CQLHelper) GetNLimit(table string, limit int, pks []*F, fields ...string) *gocql.Query {
-	keys, values := self.andKeysAndValues(pks...)
-	q := "select " + strings.Join(fields, ", ") + " from " + table + " where " + keys +
-		" limit " + strconv.Itoa(limit)
-	return self.db.Query(q, values...)
+	return self.getN(table, pks, limitClause(limit), fields).Query
 }
 
 func (self *CQLHelper) GetNLimitFilterBeforeBlockHeight(table string, limit int, beforeBH uint, pks []*F, fields ...string) *gocql.Query {
-	keys, values := self.andKeysAndValues(pks...)
-	strBeforeBH := strconv.Itoa(int(beforeBH))
-	q := "select " + strings.Join(fields, ", ") + " from " + table + " where " + keys + " and bheight<=" + strBeforeBH +
-		" limit " + strconv.Itoa(limit)
-	return self.db.Query(q, values...)
+	return self.getN(table, pks, beforeBHClause(beforeBH)+limitClause(limit), fields).Query
 }
 
 func (self *CQLHelper) GetNLimitFilterAfterBlockHeight(table string, limit int, beforeBH uint, pks []*F, fields ...string) *gocql.Query {
-	keys, values := self.andKeysAndValues(pks...)
-	strBeforeBH := strconv.Itoa(int(beforeBH))
-	q := "select " + strings.Join(fields, ", ") + " from " + table + " where " + keys + " and bheight>=" + strBeforeBH +
-		" limit " + strconv.Itoa(limit)
-	return self.db.Query(q, values...)
+	return self.getN(table, pks, afterBHClause(beforeBH)+limitClause(limit), fields).Query
 }
 
 func (self *CQLHelper) GetNLimitFilterBlockHeights(table string, limit int, beforeBH, afterBH uint, pks []*F, fields ...string) *gocql.Query {
-	keys, values := self.andKeysAndValues(pks...)
-	strBeforeBH := strconv.Itoa(int(beforeBH))
-	strAfterBH := strconv.Itoa(int(afterBH))
-	q := "select " + strings.Join(fields, ", ") + " from " + table + " where " + keys + " and bheight<=" + strBeforeBH +
-		" and bheight>=" + strAfterBH + " limit " + strconv.Itoa(limit)
-	return self.db.Query(q, values...)
+	return self.getN(table, pks, beforeBHClause(beforeBH)+afterBHClause(afterBH)+limitClause(limit), fields).Query
+}
+
+func limitClause(limit int) string {
+	return " limit " + strconv.Itoa(limit)
+}
+
+func beforeBHClause(bh uint) string {
+	return " and bheight<=" + strconv.Itoa(int(bh))
+}
+
+func afterBHClause(bh uint) string {
+	return " and bheight>=" + strconv.Itoa(int(bh))
 }
 
 func (self *CQLHelper) Save(table string, fields ...*F) error {
-	return self.save(table, false, fields...).Consistency(gocql.LocalQuorum).Exec()
+	st := self.save(table, false, fields...)
+	st.Query.Consistency(gocql.LocalQuorum)
+	return self.exec(st)
 }
 
 func (self *CQLHelper) SaveIfNotExists(table string, fields ...*F) *gocql.Query {
-	return self.save(table, true, fields...)
+	return self.save(table, true, fields...).Query
 }
 
-func (self *CQLHelper) save(table string, ine bool, fields ...*F) *gocql.Query {
-	keys := fields[0].Name
+func (self *CQLHelper) save(table string, ine bool, fields ...*F) *Statement {
+	keys := quoteColumn(fields[0].Name)
 	qs := "?"
-	values := make([]interface{}, len(fields))
-	values[0] = fields[0].Value
-
 	for n := 1; n < len(fields); n++ {
-		keys += "," + fields[n].Name
+		keys += "," + quoteColumn(fields[n].Name)
 		qs += ", ?"
-		values[n] = fields[n].Value
 	}
 	q := "insert into " + table + " (" + keys + ") values (" + qs + ")"
 	if ine {
 		q += " if not exists"
 	}
-	return self.db.Query(q, values...)
+	if self.ttl > 0 {
+		q += " using ttl " + strconv.Itoa(int(self.ttl/time.Second))
+	}
+	return self.statement(OpInsert, table, q, !ine, fields...)
+}
+
+// Saves a row from a JSON object keyed by column names. Columns missing from the object are
+// left as is rather than set to null.
+func (self *CQLHelper) SaveJSON(table string, doc []byte) error {
+	st := self.saveJSON(table, doc)
+	st.Query.Consistency(gocql.LocalQuorum)
+	return self.exec(st)
+}
+
+func (self *CQLHelper) saveJSON(table string, doc []byte) *Statement {
+	q := "insert into " + table + " json ? default unset"
+	if self.ttl > 0 {
+		q += " using ttl " + strconv.Itoa(int(self.ttl/time.Second))
+	}
+	return self.statement(OpInsert, table, q, true, &F{jsonColumn, string(doc)})
+}
+
+// Same as GetN but selects rows as JSON objects keyed by column names, each scanned as a
+// single text value.
+func (self *CQLHelper) GetNJSON(table string, pks []*F, fields ...string) *gocql.Query {
+	return self.getNJSON(table, pks, "", fields).Query
+}
+
+func (self *CQLHelper) getNJSON(table string, pks []*F, suffix string, fields []string) *Statement {
+	keys, _ := self.andKeysAndValues(pks...)
+	q := "select json " + joinColumns(fields) + " from " + table + " where " + keys + suffix
+	return self.statement(OpSelect, table, q, true, pks...)
+}
+
+// Same as FullScanIter but selects rows as JSON objects keyed by column names, each scanned
+// as a single text value.
+func (self *CQLHelper) FullScanJSON(table string, fields ...string) Iter {
+	q := "select json " + joinColumns(fields) + " from " + table
+	st := self.statement(OpSelect, table, q, true)
+	st.Query.PageSize(2000).Consistency(gocql.LocalOne)
+	return self.run(st)
 }
 
 func (self *CQLHelper) Save2If(table string, cond *F, pk1 *F, pk2 *F, fields ...*F) *gocql.Query {
-	keys, values := self.commaKeysAndValues(fields...)
+	keys, _ := self.commaKeysAndValues(fields...)
 	q := "update " + table + " set " + keys +
-		" where " + pk1.Name + " = ? and " + pk2.Name + " = ? if " + cond.Name + " = ?"
-	values = append(values, pk1.Value, pk2.Value, cond.Value)
-	return self.db.Query(q, values...)
+		" where " + quoteColumn(pk1.Name) + " = ? and " + quoteColumn(pk2.Name) + " = ? if " + quoteColumn(cond.Name) + " = ?"
+	params := append(fields[:len(fields):len(fields)], pk1, pk2, cond)
+	return self.statement(OpUpdate, table, q, false, params...).Query
 }
 
+// The iterators below are run directly by the session, bypassing interceptors (see Use),
+// their Iter counterparts going through them.
+
 func (self *CQLHelper) FullScan(table string, fields ...string) *gocql.Iter {
-	q := "select " + strings.Join(fields, ", ") + " from " + table
-	return self.db.Query(q).PageSize(2000).Consistency(gocql.LocalOne).Iter()
+	return self.fullScan(table, gocql.LocalOne, fields).Query.Iter()
 }
 
 func (self *CQLHelper) FullScanQuorum(table string, fields ...string) *gocql.Iter {
-	q := "select " + strings.Join(fields, ", ") + " from " + table
-	return self.db.Query(q).PageSize(2000).Consistency(gocql.Quorum).Iter()
+	return self.fullScan(table, gocql.Quorum, fields).Query.Iter()
 }
 
 func (self *CQLHelper) Fetch(table string, limit int, pk []*F, fields ...string) *gocql.Iter {
-	q := "select " + strings.Join(fields, ", ") + " from " + table +
-		" where "
-
-	q += pk[0].Name + "=? "
-	params := make([]interface{}, len(pk))
-	params[0] = pk[0].Value
-
-	for k, field := range pk[1:] {
-		q += " and " + field.Name + "=? "
-		params[k+1] = field.Value
-	}
-	q += " limit " + strconv.Itoa(limit)
-
-	return self.db.Query(q, params...).PageSize(2000).Consistency(gocql.LocalQuorum).Iter()
+	return self.paged(self.getN(table, pk, limitClause(limit), fields)).Query.Iter()
 }
 
 func (self *CQLHelper) Scan(table string, limit int, pk *F, fields ...string) *gocql.Iter {
-	q := "select " + strings.Join(fields, ", ") + " from " + table +
-		" where " + pk.Name + "=? limit " + strconv.Itoa(limit)
-	return self.db.Query(q, pk.Value).PageSize(2000).Consistency(gocql.LocalQuorum).Iter()
+	return self.paged(self.getN(table, []*F{pk}, limitClause(limit), fields)).Query.Iter()
 }
 
 func (self *CQLHelper) Scan2(table string, limit int, pk *F, pk2 *F, fields ...string) *gocql.Iter {
-	q := "select " + strings.Join(fields, ", ") + " from " + table +
-		" where " + pk.Name + "=? and " + pk2.Name + "=? limit " + strconv.Itoa(limit)
-	return self.db.Query(q, pk.Value, pk2.Value).PageSize(2000).Consistency(gocql.LocalQuorum).Iter()
+	return self.paged(self.getN(table, []*F{pk, pk2}, limitClause(limit), fields)).Query.Iter()
 }
 
+// Runs an arbitrary statement. It's not known to be idempotent so it's never retried.
 func (self *CQLHelper) Query(q string, params ...interface{}) *gocql.Iter {
-	return self.db.Query(q, params...).Consistency(gocql.LocalQuorum).PageSize(2000).Iter()
+	return self.paged(self.query(q, params)).Query.Iter()
+}
+
+// Same as FullScan, going through interceptors.
+func (self *CQLHelper) FullScanIter(table string, fields ...string) Iter {
+	return self.run(self.fullScan(table, gocql.LocalOne, fields))
+}
+
+// Same as FullScanQuorum, going through interceptors.
+func (self *CQLHelper) FullScanQuorumIter(table string, fields ...string) Iter {
+	return self.run(self.fullScan(table, gocql.Quorum, fields))
+}
+
+// Same as Fetch, going through interceptors.
+func (self *CQLHelper) FetchIter(table string, limit int, pk []*F, fields ...string) Iter {
+	return self.iter(self.getN(table, pk, limitClause(limit), fields))
+}
+
+// Same as Scan, going through interceptors.
+func (self *CQLHelper) ScanIter(table string, limit int, pk *F, fields ...string) Iter {
+	return self.iter(self.getN(table, []*F{pk}, limitClause(limit), fields))
+}
+
+// Same as Scan2, going through interceptors.
+func (self *CQLHelper) Scan2Iter(table string, limit int, pk *F, pk2 *F, fields ...string) Iter {
+	return self.iter(self.getN(table, []*F{pk, pk2}, limitClause(limit), fields))
+}
+
+// Same as Query, going through interceptors.
+func (self *CQLHelper) QueryIter(q string, params ...interface{}) Iter {
+	return self.iter(self.query(q, params))
+}
+
+func (self *CQLHelper) fullScan(table string, cons gocql.Consistency, fields []string) *Statement {
+	q := "select " + joinColumns(fields) + " from " + table
+	st := self.statement(OpSelect, table, q, true)
+	st.Query.PageSize(2000).Consistency(cons)
+	return st
+}
+
+func (self *CQLHelper) query(q string, params []interface{}) *Statement {
+	fields := make([]*F, len(params))
+	for n, param := range params {
+		fields[n] = &F{"", param}
+	}
+	return self.statement(OpRaw, "", q, false, fields...)
+}
+
+// Sets the default paging and consistency of statements returning rows.
+func (self *CQLHelper) paged(st *Statement) *Statement {
+	st.Query.PageSize(2000).Consistency(gocql.LocalQuorum)
+	return st
+}
+
+// Runs a statement returning rows with the default paging and consistency.
+func (self *CQLHelper) iter(st *Statement) Iter {
+	return self.run(self.paged(st))
 }
 
 func (self *CQLHelper) Delete(table string, kvs ...*F) error {
-	keys, values := self.andKeysAndValues(kvs...)
-	return self.db.Query("delete from "+table+" where "+keys, values...).Consistency(gocql.LocalQuorum).Exec()
+	keys, _ := self.andKeysAndValues(kvs...)
+	q := "delete from " + table + " where " + keys
+	st := self.statement(OpDelete, table, q, true, kvs...)
+	st.Query.Consistency(gocql.LocalQuorum)
+	return self.exec(st)
 }
 
 func (self *CQLHelper) DeleteBy(table string, id string, value interface{}) error {
-	q := "delete from " + table + " where " + id + "=?"
-	return self.db.Query(q, value).Consistency(gocql.LocalQuorum).Exec()
+	q := "delete from " + table + " where " + quoteColumn(id) + "=?"
+	st := self.statement(OpDelete, table, q, true, &F{id, value})
+	st.Query.Consistency(gocql.LocalQuorum)
+	return self.exec(st)
+}
+
+// Bound on a clustering column, restricting the rows of a partition.
+type Bound struct {
+	Name  string
+	Op    string // one of =, <, <=, > or >=
+	Value interface{}
+}
+
+func Eq(name string, value interface{}) *Bound { return &Bound{name, "=", value} }
+func Lt(name string, value interface{}) *Bound { return &Bound{name, "<", value} }
+func Le(name string, value interface{}) *Bound { return &Bound{name, "<=", value} }
+func Gt(name string, value interface{}) *Bound { return &Bound{name, ">", value} }
+func Ge(name string, value interface{}) *Bound { return &Bound{name, ">=", value} }
+
+// Same as GetN but also restricts rows with bounds on clustering columns.
+func (self *CQLHelper) GetNRange(table string, pks []*F, bounds []*Bound, fields ...string) *gocql.Query {
+	return self.getNRange(table, pks, bounds, fields).Query
+}
+
+func (self *CQLHelper) getNRange(table string, pks []*F, bounds []*Bound, fields []string) *Statement {
+	where, params := self.whereBounds(pks, bounds)
+	q := "select " + joinColumns(fields) + " from " + table + " where " + where
+	return self.statement(OpSelect, table, q, true, params...)
+}
+
+// Deletes the provided columns, or whole rows when none, of the rows matching the keys and
+// bounds. Bounds on clustering columns make range tombstones, no keys at all but the
+// partition ones a partition tombstone.
+func (self *CQLHelper) DeleteWhere(table string, cols []string, keys []*F, bounds ...*Bound) error {
+	return self.exec(self.deleteWhere(table, cols, keys, bounds))
+}
+
+func (self *CQLHelper) deleteWhere(table string, cols []string, keys []*F, bounds []*Bound) *Statement {
+	where, params := self.whereBounds(keys, bounds)
+	q := "delete "
+	if len(cols) > 0 {
+		q += joinColumns(cols) + " "
+	}
+	q += "from " + table + " where " + where
+	st := self.statement(OpDelete, table, q, true, params...)
+	st.Query.Consistency(gocql.LocalQuorum)
+	return st
+}
+
+// Where clause matching the keys and bounds, along with the fields to bind.
+func (self *CQLHelper) whereBounds(keys []*F, bounds []*Bound) (string, []*F) {
+	where, _ := self.andKeysAndValues(keys...)
+	params := keys[:len(keys):len(keys)]
+	for _, bound := range bounds {
+		where += " and " + quoteColumn(bound.Name) + " " + bound.Op + " ?"
+		params = append(params, &F{bound.Name, bound.Value})
+	}
+	return where, params
 }
 
 func queryValues(q *gocql.Query, n int) ([]interface{}, error) {
@@ -167,7 +427,7 @@ func queryValues(q *gocql.Query, n int) ([]interface{}, error) {
 	// error is same as iterator error returned on close
 	iter := q.Iter()
 	iter.Scan(sl...)
-	return sl, iter.Close()
+	return sl, classify(iter.Close())
 }
 
 func (self *CQLHelper) andKeysAndValues(ks ...*F) (string, []interface{}) {
@@ -183,7 +443,7 @@ func (self *CQLHelper) sepKeysAndValues(sep string, kvs ...*F) (string, []interf
 	values := make([]interface{}, len(kvs))
 
 	for n, field := range kvs {
-		keys += field.Name + " = ?"
+		keys += quoteColumn(field.Name) + " = ?"
 		if n < len(kvs)-1 {
 			keys += sep
 		}
@@ -192,11 +452,21 @@ func (self *CQLHelper) sepKeysAndValues(sep string, kvs ...*F) (string, []interf
 	return keys, values
 }
 
-// Utility function to eliminate not found errors
-func ENF(err error) error {
-	if err == gocql.ErrNotFound {
-		return nil
-	} else {
-		return err
+// Quotes column names which aren't lower case, leaving expressions, like token(hash), as is.
+func quoteColumn(name string) string {
+	for _, r := range name {
+		if !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_') {
+			return name
+		}
+	}
+	return QuoteIdent(name)
+}
+
+// Column names, quoted if needed, separated by commas.
+func joinColumns(cols []string) string {
+	quoted := make([]string, len(cols))
+	for n, col := range cols {
+		quoted[n] = quoteColumn(col)
 	}
+	return strings.Join(quoted, ", ")
 }
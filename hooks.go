@@ -0,0 +1,92 @@
+package dago
+
+import (
+	"context"
+)
+
+// Hooks a DAO can optionally implement, receiving the context of the DataAccess (see
+// WithContext). An error returned by a Before hook aborts the operation and is returned as
+// is, After hooks are told about the outcome of the operation. They are called alongside
+// the older DAOPreHook, DAOPostSaveHook and DAOPostHook.
+//
+// Save hooks are called by Save, SaveTable, SavePartial, SaveIfNotExists and SaveJSON, the
+// latter passing them the DAO it was given rather than the saved values. Delete hooks are
+// called by Delete and DeleteFields, and by DeletePartition and DeleteRange once with the DAO
+// holding the partition keys rather than per deleted row, which includes Rollback. Load hooks
+// are called for every row read into a DAO, except on cache hits. Rows copied to orphan tables
+// by Rollback and JSON imports of the dago command don't go through hooks.
+type DAOBeforeSaveHook interface {
+	BeforeSave(ctx context.Context) error
+}
+type DAOAfterSaveHook interface {
+	AfterSave(ctx context.Context, err error)
+}
+type DAOBeforeDeleteHook interface {
+	BeforeDelete(ctx context.Context) error
+}
+type DAOAfterDeleteHook interface {
+	AfterDelete(ctx context.Context, err error)
+}
+type DAOAfterLoadHook interface {
+	AfterLoad(ctx context.Context) error
+}
+
+func (self *DataAccess) beforeSave(dao DAOLite) error {
+	if daopre, ok := dao.(DAOPreHook); ok {
+		daopre.PreSave()
+	}
+	if daopre, ok := dao.(DAOBeforeSaveHook); ok {
+		return daopre.BeforeSave(self.ctx)
+	}
+	return nil
+}
+
+func (self *DataAccess) afterSave(dao DAOLite, err error) {
+	if daopost, ok := dao.(DAOPostSaveHook); ok && err == nil {
+		daopost.PostSave()
+	}
+	if daopost, ok := dao.(DAOAfterSaveHook); ok {
+		daopost.AfterSave(self.ctx, err)
+	}
+}
+
+func (self *DataAccess) beforeDelete(dao DAOLite) error {
+	if daopre, ok := dao.(DAOBeforeDeleteHook); ok {
+		return daopre.BeforeDelete(self.ctx)
+	}
+	return nil
+}
+
+func (self *DataAccess) afterDelete(dao DAOLite, err error) {
+	if daopost, ok := dao.(DAOAfterDeleteHook); ok {
+		daopost.AfterDelete(self.ctx, err)
+	}
+}
+
+func (self *DataAccess) afterLoad(dao DAOLite) error {
+	if daopost, ok := dao.(DAOPostHook); ok {
+		daopost.PostLoad()
+	}
+	if daopost, ok := dao.(DAOAfterLoadHook); ok {
+		return daopost.AfterLoad(self.ctx)
+	}
+	return nil
+}
+
+// Iterator returned by DataAccess, keeping the first AfterLoad hook error met by Next so
+// that it's returned on Close.
+type hookIter struct {
+	Iter
+	err error
+	// fields scanned by Next, when rows hold all of them rather than the ones not known from
+	// the partition keys
+	fields []string
+}
+
+func (self *hookIter) Close() error {
+	err := self.Iter.Close()
+	if self.err != nil {
+		return self.err
+	}
+	return classify(err)
+}
@@ -0,0 +1,109 @@
+package dago
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ctxKey struct{}
+
+type HookedDao struct {
+	Key      string `column:"key,key"`
+	Value    string `column:"value"`
+	preSaved bool
+	ctxValue interface{}
+	loaded   bool
+}
+
+func (self *HookedDao) TableName() string {
+	return "hooked_dao"
+}
+
+func (self *HookedDao) PreSave() {
+	self.preSaved = true
+}
+
+func (self *HookedDao) BeforeSave(ctx context.Context) error {
+	self.ctxValue = ctx.Value(ctxKey{})
+	return errors.New("not today")
+}
+
+func (self *HookedDao) BeforeDelete(ctx context.Context) error {
+	return errors.New("never")
+}
+
+func (self *HookedDao) AfterLoad(ctx context.Context) error {
+	self.loaded = true
+	return nil
+}
+
+func TestHooks(t *testing.T) {
+	da := NewDataAccess(NewCQLHelper(nil)).WithContext(context.WithValue(context.Background(), ctxKey{}, 42))
+	dao := &HookedDao{}
+
+	// failing before hooks abort operations before anything is sent to the session
+	assert.EqualError(t, da.Save(dao), "not today")
+	assert.True(t, dao.preSaved)
+	assert.Equal(t, 42, dao.ctxValue)
+	assert.EqualError(t, da.SavePartial(dao, "Value"), "not today")
+	assert.EqualError(t, da.SaveJSON(dao, []byte(`{"key": "a"}`)), "not today")
+	assert.EqualError(t, da.Delete(dao), "never")
+	assert.EqualError(t, da.DeleteFields(dao, "Value"), "never")
+	assert.EqualError(t, da.DeletePartition(dao), "never")
+
+	assert.NoError(t, da.afterLoad(dao))
+	assert.True(t, dao.loaded)
+}
+
+type WatchedDao struct {
+	Key      string `column:"key,key"`
+	Value    string `column:"value,sort"`
+	postSave bool
+	saveErr  error
+	loaded   int
+}
+
+func (self *WatchedDao) TableName() string {
+	return "watched_dao"
+}
+
+func (self *WatchedDao) PostSave() {
+	self.postSave = true
+}
+
+func (self *WatchedDao) AfterSave(ctx context.Context, err error) {
+	self.saveErr = err
+}
+
+func (self *WatchedDao) AfterLoad(ctx context.Context) error {
+	self.loaded++
+	if self.Value == "bad" {
+		return errors.New("bad value")
+	}
+	return nil
+}
+
+func TestAfterHooks(t *testing.T) {
+	writeErr := errors.New("write timeout")
+	_, da := newRecorder(func(st *Statement) ([][]interface{}, error) {
+		if st.Op == OpInsert {
+			return nil, writeErr
+		}
+		return [][]interface{}{{"bad"}, {"good"}}, nil
+	})
+
+	// after hooks are told about failed writes, post hooks only run on success
+	dao := &WatchedDao{Key: "a"}
+	assert.ErrorIs(t, da.Save(dao), writeErr)
+	assert.ErrorIs(t, dao.saveErr, writeErr)
+	assert.False(t, dao.postSave)
+
+	// iterating stops on the first AfterLoad error, returned by Close
+	iter := da.PartitionIter(dao)
+	assert.False(t, da.Next(iter, dao))
+	assert.Equal(t, 1, dao.loaded)
+	assert.EqualError(t, iter.Close(), "bad value")
+}
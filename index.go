@@ -0,0 +1,211 @@
+package dago
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// Index classes by column tag qualifier, see TagQualifiers.
+var indexClasses = map[string]string{
+	"index":      IndexNative,
+	"index=sai":  IndexSAI,
+	"index=sasi": IndexSASI,
+}
+
+// Classes of secondary indexes.
+const (
+	IndexNative = "native"
+	IndexSAI    = "StorageAttachedIndex"
+	IndexSASI   = "org.apache.cassandra.index.sasi.SASIIndex"
+)
+
+// Secondary index on a column of a table.
+type IndexSchema struct {
+	Name   string
+	Column string
+	Class  string // see IndexNative, IndexSAI and IndexSASI, or any custom index class
+}
+
+// Index on the named column, nil if none.
+func (self *TableSchema) Index(column string) *IndexSchema {
+	for _, idx := range self.Indexes {
+		if idx.Column == column {
+			return idx
+		}
+	}
+	return nil
+}
+
+// CREATE TABLE statement of the table, followed by the CREATE INDEX or CREATE CUSTOM INDEX
+// ones of its indexes, or CREATE MATERIALIZED VIEW statement of a view, all terminated by a
+// semicolon and a newline.
+// Example:
+//
+//	info, _ := da.Registry().Lookup(&Tx{})
+//	fmt.Print(info.Schema(&Tx{}).CQL())
+func (self *TableSchema) CQL() string {
+	name := QuoteIdent(self.Name)
+	if self.Keyspace != "" {
+		name = QuoteIdent(self.Keyspace) + "." + name
+	}
+	if self.Base != "" {
+		return self.viewCQL(name)
+	}
+	var sb strings.Builder
+	sb.WriteString("CREATE TABLE " + name + " (\n")
+	for _, col := range self.Columns {
+		sb.WriteString("    " + QuoteIdent(col.Name) + " " + col.Type + ",\n")
+	}
+	sb.WriteString("    " + self.primaryKeyCQL() + "\n);\n")
+
+	for _, idx := range self.Indexes {
+		stmt := "CREATE INDEX "
+		if idx.Class != IndexNative {
+			stmt = "CREATE CUSTOM INDEX "
+		}
+		stmt += QuoteIdent(idx.Name) + " ON " + name + " (" + QuoteIdent(idx.Column) + ")"
+		if idx.Class != IndexNative {
+			stmt += " USING '" + idx.Class + "'"
+		}
+		sb.WriteString(stmt + ";\n")
+	}
+	return sb.String()
+}
+
+func (self *TableSchema) primaryKeyCQL() string {
+	partition := make([]string, 0, len(self.Columns))
+	for _, col := range self.PartitionKeys() {
+		partition = append(partition, QuoteIdent(col.Name))
+	}
+	key := []string{"(" + strings.Join(partition, ", ") + ")"}
+	for _, col := range self.ClusteringKeys() {
+		key = append(key, QuoteIdent(col.Name))
+	}
+	return "PRIMARY KEY (" + strings.Join(key, ", ") + ")"
+}
+
+// Name of the index created on the column by default.
+func indexName(table, column string) string {
+	return strings.Trim(table, `"`) + "_" + strings.Trim(column, `"`) + "_idx"
+}
+
+// Quotes CQL names which would otherwise be lower cased or aren't identifiers, like column
+// names in statements.
+func QuoteIdent(name string) string {
+	if strings.HasPrefix(name, `"`) {
+		return name
+	}
+	for n, r := range name {
+		if !(r >= 'a' && r <= 'z' || r == '_' || n > 0 && r >= '0' && r <= '9') {
+			return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+		}
+	}
+	return name
+}
+
+// Returns a copy of the DataAccess running FindBy queries on columns without a secondary
+// index with ALLOW FILTERING, which makes Cassandra read and filter whole tables. Only use it
+// on small tables or along with partition keys.
+// Example:
+//
+//	iter := da.AllowFiltering().FindBy(&Block{}, "Miner", miner)
+func (self *DataAccess) AllowFiltering() *DataAccess {
+	da := *self
+	da.allowFiltering = true
+	return &da
+}
+
+// Creates an iterator to go over all rows having the provided value for the field, through
+// the secondary index of its column. Indexes are looked up in system_schema.indexes, in the
+// keyspace of the table or else the one the CassandraDb was opened with, a missing index
+// being an error unless filtering is allowed. See AllowFiltering.
+// Example:
+//
+//	block := &Block{}
+//	iter := da.FindBy(block, "Height", 481824)
+//	for da.Next(iter, block) {...}
+//	err := iter.Close()
+func (self *DataAccess) FindBy(dao DAOLite, field string, value interface{}) Iter {
+	if err := self.check(dao); err != nil {
+		return ErrorIter(err)
+	}
+	info, _ := self.registry.Lookup(dao)
+	col := info.column(field)
+	if col == nil {
+		return ErrorIter(&DefinitionError{info.Type, field, "no such persisted field"})
+	}
+	table := self.tableOf(dao)
+	suffix := ""
+	if col.Kind != PARTITION_KEY || len(info.PartitionKeyColumns()) > 1 {
+		indexed, err := self.indexed(table, col.Column)
+		if err != nil {
+			return ErrorIter(err)
+		}
+		if !indexed {
+			if !self.allowFiltering {
+				return ErrorIter(errors.New("dago: no secondary index on column " + col.Column + " of table " + table +
+					", see AllowFiltering"))
+			}
+			suffix = " allow filtering"
+		}
+	}
+	if value == nil {
+		return ErrorIter(errors.New("dago: nil value for " + field + ", NULL columns can't be found"))
+	}
+	helper := self.helperFor(dao)
+	st := helper.getN(table, []*F{{col.Column, self.bind(reflect.ValueOf(value))}}, suffix, self.ColNamesOfKind(dao, ANY))
+	return &hookIter{Iter: helper.iter(st), fields: self.FieldNamesOfKind(dao, ANY)}
+}
+
+// Tells whether the column of the table has a secondary index, caching positive answers.
+func (self *DataAccess) indexed(table, column string) (bool, error) {
+	keyspace, name := self.helper.keyspace, table
+	if dot := strings.Index(table, "."); dot >= 0 {
+		keyspace, name = table[:dot], table[dot+1:]
+	}
+	if keyspace == "" {
+		return false, errors.New("dago: no keyspace to look the indexes of table " + table + " up in, see In")
+	}
+	key := strings.Trim(keyspace, `"`) + "." + strings.Trim(name, `"`) + "." + strings.Trim(column, `"`)
+	if self.registry.hasIndex(key) {
+		return true, nil
+	}
+	iter := self.helper.QueryIter("select options from system_schema.indexes where keyspace_name = ? and table_name = ?",
+		strings.Trim(keyspace, `"`), strings.Trim(name, `"`))
+	var options map[string]string
+	found := false
+	for iter.Scan(&options) {
+		found = found || indexTarget(options["target"]) == strings.Trim(column, `"`)
+	}
+	if err := iter.Close(); err != nil {
+		return false, classify(err)
+	}
+	if found {
+		self.registry.addIndex(key)
+	}
+	return found, nil
+}
+
+// Column indexed according to the target option of an index, like values(tags) or "Value".
+func indexTarget(target string) string {
+	if open := strings.Index(target, "("); open >= 0 && strings.HasSuffix(target, ")") {
+		target = target[open+1 : len(target)-1]
+	}
+	return strings.ReplaceAll(strings.Trim(target, `"`), `""`, `"`)
+}
+
+func (self *Registry) hasIndex(key string) bool {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	return self.indexes[key]
+}
+
+func (self *Registry) addIndex(key string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.indexes == nil {
+		self.indexes = make(map[string]bool)
+	}
+	self.indexes[key] = true
+}
@@ -0,0 +1,102 @@
+package dago
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type IndexedBlock struct {
+	Hash     string `column:"hash,key"`
+	Height   int64  `column:"height,index"`
+	Miner    string `column:"Miner,index=sasi"`
+	Coinbase string `column:"coinbase,index=sai"`
+	Fees     int64  `column:"fees"`
+}
+
+func (self *IndexedBlock) TableName() string {
+	return "blocks"
+}
+
+func TestIndexSchemaCQL(t *testing.T) {
+	info, err := NewRegistry().Register(&IndexedBlock{}, WithKeyspace("bitcoin"))
+	assert.NoError(t, err)
+	assert.Equal(t, `CREATE TABLE bitcoin.blocks (
+    hash text,
+    height bigint,
+    "Miner" text,
+    coinbase text,
+    fees bigint,
+    PRIMARY KEY ((hash))
+);
+CREATE INDEX blocks_height_idx ON bitcoin.blocks (height);
+CREATE CUSTOM INDEX "blocks_Miner_idx" ON bitcoin.blocks ("Miner") USING 'org.apache.cassandra.index.sasi.SASIIndex';
+CREATE CUSTOM INDEX blocks_coinbase_idx ON bitcoin.blocks (coinbase) USING 'StorageAttachedIndex';
+`, info.Schema(&IndexedBlock{}).CQL())
+}
+
+func TestParseCQLIndexes(t *testing.T) {
+	tables, err := ParseCQLSchema(testSchema + `
+CREATE CUSTOM INDEX IF NOT EXISTS outs_memo ON bitcoin.addr_outputs (memo) USING 'StorageAttachedIndex' WITH OPTIONS = {'case_sensitive': 'false'};
+CREATE INDEX ON bitcoin.addr_outputs (values(spent_by));
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, []*IndexSchema{
+		{"outs_memo", "memo", IndexSAI},
+		{"addr_outputs_spent_by_idx", "spent_by", IndexNative},
+	}, tables[0].Indexes)
+	assert.Equal(t, []*IndexSchema{{"blocks_height_idx", "height", IndexNative}}, tables[1].Indexes)
+
+	// round trip through the generated CQL
+	parsed, err := ParseCQLSchema(tables[0].CQL())
+	assert.NoError(t, err)
+	assert.Equal(t, tables[0], parsed[0])
+
+	_, err = ParseCQLSchema("CREATE INDEX ON txs (height);")
+	assert.EqualError(t, err, "dago: index on unknown table txs")
+}
+
+func TestIndexTarget(t *testing.T) {
+	assert.Equal(t, "height", indexTarget("height"))
+	assert.Equal(t, "tags", indexTarget("values(tags)"))
+	assert.Equal(t, "Value", indexTarget(`"Value"`))
+}
+
+func TestFindByErrors(t *testing.T) {
+	da := NewDataAccess(NewCQLHelper(nil))
+	err := da.FindBy(&IndexedBlock{}, "Nonce", 0).Close()
+	assert.EqualError(t, err, "dago: invalid DAO *dago.IndexedBlock: field Nonce: no such persisted field")
+	err = da.FindBy(&IndexedBlock{}, "Height", 0).Close()
+	assert.EqualError(t, err, "dago: no keyspace to look the indexes of table blocks up in, see In")
+
+	// known indexes are shared by copies
+	da.registry.addIndex("bitcoin.blocks.height")
+	assert.True(t, da.AllowFiltering().registry.hasIndex("bitcoin.blocks.height"))
+	assert.True(t, da.AllowFiltering().allowFiltering)
+	assert.False(t, da.allowFiltering)
+}
+
+func TestQuotedColumns(t *testing.T) {
+	rec, da := newRecorder(func(st *Statement) ([][]interface{}, error) {
+		if st.Op == OpRaw {
+			return [][]interface{}{{map[string]string{"target": `"Miner"`}}}, nil
+		}
+		return nil, nil
+	})
+	da = da.In("bitcoin")
+	assert.NoError(t, da.Save(&IndexedBlock{Hash: "00ab", Miner: "f2pool"}))
+	assert.NoError(t, da.FindBy(&IndexedBlock{}, "Miner", "f2pool").Close())
+	assert.NoError(t, da.DeleteFields(&IndexedBlock{Hash: "00ab"}, "Miner"))
+	assert.Equal(t, []string{
+		`insert into bitcoin.blocks (hash,height,"Miner",coinbase,fees) values (?, ?, ?, ?, ?)`,
+		"select options from system_schema.indexes where keyspace_name = ? and table_name = ?",
+		`select hash, height, "Miner", coinbase, fees from bitcoin.blocks where "Miner" = ?`,
+		`delete "Miner" from bitcoin.blocks where hash = ?`,
+	}, rec.CQL())
+
+	// NULL columns can't be matched
+	err := da.FindBy(&IndexedBlock{}, "Miner", nil).Close()
+	assert.EqualError(t, err, "dago: nil value for Miner, NULL columns can't be found")
+	err = da.DeleteRange(&HeightDao{Address: "1A1z"}, Gt("Height", nil))
+	assert.EqualError(t, err, "dago: nil range bound value on Height")
+}
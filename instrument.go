@@ -0,0 +1,210 @@
+package dago
+
+import (
+	"context"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Minimal tracing facility used to record a span per DataAccess operation and statement,
+// easily backed by OpenTelemetry (see Instrument).
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+type Span interface {
+	SetAttribute(key string, value interface{})
+	// Ends the span, err being the outcome of the statement
+	End(err error)
+}
+
+// Receives the measurements of every statement, to be backed by Prometheus counters and
+// histograms or similar.
+type Metrics interface {
+	ObserveLatency(op Op, table string, d time.Duration)
+	IncErrors(op Op, table string)
+	AddRowsRead(table string, n int)
+	AddRowsWritten(table string, n int)
+}
+
+type NopTracer struct{}
+
+func (NopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttribute(key string, value interface{}) {}
+func (nopSpan) End(err error)                              {}
+
+type NopMetrics struct{}
+
+func (NopMetrics) ObserveLatency(op Op, table string, d time.Duration) {}
+func (NopMetrics) IncErrors(op Op, table string)                       {}
+func (NopMetrics) AddRowsRead(table string, n int)                     {}
+func (NopMetrics) AddRowsWritten(table string, n int)                  {}
+
+// Records a span and metrics for every statement executed through the CassandraDb,
+// including all DataAccess operations. Either tracer or metrics can be nil.
+//
+// DataAccess operations (Get, GetMany, Save, SavePartial, SaveIfNotExists, SaveJSON, Delete,
+// DeleteFields, DeletePartition, DeleteRange, CopyTable and Rollback) get a span named after
+// the operation and table, like "dago.GetMany outputs", the spans of the statements they run
+// being its children. Statement spans are named after the statement kind and table, like
+// "dago.select outputs". Both carry the dago.table, dago.op, dago.dao, dago.consistency and
+// dago.rows attributes, operation spans also carrying dago.operation. Operations over several
+// DAOs are described by their first one, their rows being the ones found, written or
+// removed, and left out when unknown, like for partition deletes.
+//
+// Measurements are taken per statement, when its iterator is closed, so latencies of reads
+// include iterating over all rows.
+// Example, with an OpenTelemetry adapter:
+//
+//	type otelTracer struct{ trace.Tracer }
+//
+//	func (self otelTracer) Start(ctx context.Context, name string) (context.Context, dago.Span) {
+//		ctx, span := self.Tracer.Start(ctx, name)
+//		return ctx, otelSpan{span}
+//	}
+//	...
+//	db.Instrument(otelTracer{otel.Tracer("dago")}, promMetrics)
+func (self *CassandraDb) Instrument(tracer Tracer, metrics Metrics) {
+	self.helper.tracer = tracer
+	self.Use(instrumentation(tracer, metrics))
+}
+
+func instrumentation(tracer Tracer, metrics Metrics) Interceptor {
+	if tracer == nil {
+		tracer = NopTracer{}
+	}
+	if metrics == nil {
+		metrics = NopMetrics{}
+	}
+	return func(ctx context.Context, st *Statement, next Invoker) Iter {
+		ctx, span := tracer.Start(ctx, "dago."+string(st.Op)+" "+st.Table)
+		span.SetAttribute("dago.table", st.Table)
+		span.SetAttribute("dago.op", string(st.Op))
+		if st.DAOType != nil {
+			span.SetAttribute("dago.dao", st.DAOType.String())
+		}
+		if st.Query != nil {
+			span.SetAttribute("dago.consistency", st.Query.GetConsistency().String())
+		}
+		return &instrumentedIter{next(ctx, st), st, span, metrics, time.Now(), 0}
+	}
+}
+
+// Counts rows as they are scanned, recording everything on close.
+type instrumentedIter struct {
+	Iter
+	st      *Statement
+	span    Span
+	metrics Metrics
+	start   time.Time
+	rows    int
+}
+
+func (self *instrumentedIter) Scan(dest ...interface{}) bool {
+	if self.Iter.Scan(dest...) {
+		self.rows++
+		return true
+	}
+	return false
+}
+
+func (self *instrumentedIter) MapScan(m map[string]interface{}) bool {
+	if ms, ok := self.Iter.(MapScanner); ok && ms.MapScan(m) {
+		self.rows++
+		return true
+	}
+	return false
+}
+
+func (self *instrumentedIter) Close() error {
+	err := self.Iter.Close()
+	table := self.st.Table
+	self.metrics.ObserveLatency(self.st.Op, table, time.Since(self.start))
+	if err != nil {
+		self.metrics.IncErrors(self.st.Op, table)
+	}
+	switch self.st.Op {
+	case OpSelect:
+		self.metrics.AddRowsRead(table, self.rows)
+	case OpInsert, OpUpdate, OpDelete:
+		if err == nil {
+			self.metrics.AddRowsWritten(table, 1)
+		}
+	case OpBatch:
+		if err == nil {
+			self.metrics.AddRowsWritten(table, len(self.st.Statements))
+		}
+	}
+	self.span.SetAttribute("dago.rows", self.rows)
+	self.span.End(err)
+	return err
+}
+
+// Span of a DataAccess operation.
+type opSpan struct {
+	span Span
+}
+
+// Starts the span of an operation on the DAO, nil for none, returning the DataAccess to run
+// the operation with so that statement spans are children of the operation one. Both are
+// left as is when not instrumented.
+func (self *DataAccess) startSpan(name string, op Op, dao DAOLite) (*DataAccess, *opSpan) {
+	tracer := self.helper.tracer
+	if tracer == nil {
+		return self, nil
+	}
+	table := ""
+	if dao != nil {
+		table = self.tableOf(dao)
+	}
+	ctx, span := tracer.Start(self.ctx, "dago."+name+" "+table)
+	span.SetAttribute("dago.table", table)
+	span.SetAttribute("dago.op", string(op))
+	span.SetAttribute("dago.operation", name)
+	if dao != nil {
+		if info, err := self.registry.Lookup(dao); err == nil {
+			span.SetAttribute("dago.dao", info.Type.String())
+			consistency := gocql.LocalQuorum
+			if info.Consistency != nil {
+				consistency = *info.Consistency
+			}
+			span.SetAttribute("dago.consistency", consistency.String())
+		}
+	}
+	return self.WithContext(ctx), &opSpan{span}
+}
+
+// Ends the span with the outcome of the operation and the rows it read or wrote, negative
+// when unknown. Returns the error for convenience.
+func (self *opSpan) end(err error, rows int) error {
+	if self == nil {
+		return err
+	}
+	if rows >= 0 {
+		self.span.SetAttribute("dago.rows", rows)
+	}
+	self.span.End(err)
+	return err
+}
+
+// Same as end for operations on a single row.
+func (self *opSpan) endRow(err error) error {
+	if err != nil {
+		return self.end(err, 0)
+	}
+	return self.end(err, 1)
+}
+
+// First of the DAOs, nil if none.
+func first(daos []DAOLite) DAOLite {
+	if len(daos) == 0 {
+		return nil
+	}
+	return daos[0]
+}
@@ -0,0 +1,207 @@
+package dago
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+type spanKey struct{}
+
+// Records spans along with their parent, found in the context.
+type fakeTracer struct {
+	mutex sync.Mutex
+	spans []*fakeSpan
+}
+
+type fakeSpan struct {
+	tracer *fakeTracer
+	name   string
+	parent *fakeSpan
+	attrs  map[string]interface{}
+	ended  bool
+	err    error
+}
+
+func (self *fakeTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(*fakeSpan)
+	span := &fakeSpan{tracer: self, name: name, parent: parent, attrs: make(map[string]interface{})}
+	self.mutex.Lock()
+	self.spans = append(self.spans, span)
+	self.mutex.Unlock()
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Spans with the name, in start order.
+func (self *fakeTracer) named(name string) []*fakeSpan {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	spans := []*fakeSpan{}
+	for _, span := range self.spans {
+		if span.name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func (self *fakeSpan) SetAttribute(key string, value interface{}) {
+	self.tracer.mutex.Lock()
+	defer self.tracer.mutex.Unlock()
+	self.attrs[key] = value
+}
+
+func (self *fakeSpan) End(err error) {
+	self.tracer.mutex.Lock()
+	defer self.tracer.mutex.Unlock()
+	self.ended, self.err = true, err
+}
+
+// Root of the span, itself if it has no parent.
+func (self *fakeSpan) root() *fakeSpan {
+	span := self
+	for span.parent != nil {
+		span = span.parent
+	}
+	return span
+}
+
+type fakeMetrics struct {
+	mutex     sync.Mutex
+	latencies map[Op]int
+	errors    map[Op]int
+	read      map[string]int
+	written   map[string]int
+}
+
+func newFakeMetrics() *fakeMetrics {
+	return &fakeMetrics{latencies: map[Op]int{}, errors: map[Op]int{}, read: map[string]int{}, written: map[string]int{}}
+}
+
+func (self *fakeMetrics) ObserveLatency(op Op, table string, d time.Duration) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.latencies[op]++
+}
+
+func (self *fakeMetrics) IncErrors(op Op, table string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.errors[op]++
+}
+
+func (self *fakeMetrics) AddRowsRead(table string, n int) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.read[table] += n
+}
+
+func (self *fakeMetrics) AddRowsWritten(table string, n int) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.written[table] += n
+}
+
+// Instrumented CassandraDb whose statements are recorded, see newRecorder.
+func newInstrumented(answer func(st *Statement) ([][]interface{}, error)) (*fakeTracer, *fakeMetrics, *DataAccess) {
+	tracer, metrics := &fakeTracer{}, newFakeMetrics()
+	db := Wrap(&gocql.Session{})
+	db.Instrument(tracer, metrics)
+	db.Use((&recorder{answer: answer}).intercept)
+	return tracer, metrics, db.GetDA()
+}
+
+func TestInstrumentOperations(t *testing.T) {
+	tracer, metrics, da := newInstrumented(func(st *Statement) ([][]interface{}, error) {
+		if st.Op == OpSelect && st.Values[0] == "foo" {
+			return [][]interface{}{{time.Unix(42, 0), big.NewInt(42), true}}, nil
+		}
+		return nil, nil
+	})
+	daos := []DAOLite{
+		&SimpleDao{AString: "foo", SomeBytes: []byte{1}},
+		&SimpleDao{AString: "bar", SomeBytes: []byte{2}},
+	}
+	found, err := da.GetMany(daos)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, false}, found)
+
+	// a single operation span, the ones of the rows and statements being its descendants
+	ops := tracer.named("dago.GetMany simple_dao")
+	if assert.Len(t, ops, 1) {
+		op := ops[0]
+		assert.Nil(t, op.parent)
+		assert.True(t, op.ended)
+		assert.Equal(t, map[string]interface{}{
+			"dago.table":       "simple_dao",
+			"dago.op":          "select",
+			"dago.operation":   "GetMany",
+			"dago.dao":         "*dago.SimpleDao",
+			"dago.consistency": "LOCAL_QUORUM",
+			"dago.rows":        1,
+		}, op.attrs)
+		selects := tracer.named("dago.select simple_dao")
+		assert.Len(t, selects, 2)
+		for _, span := range append(selects, tracer.named("dago.Get simple_dao")...) {
+			assert.Equal(t, op, span.root())
+		}
+	}
+	assert.Equal(t, 2, metrics.latencies[OpSelect])
+	assert.Equal(t, 1, metrics.read["simple_dao"])
+
+	assert.NoError(t, da.Save(&SimpleDao{AString: "foo", SomeBytes: []byte{1}}))
+	if saves := tracer.named("dago.Save simple_dao"); assert.Len(t, saves, 1) {
+		assert.Equal(t, 1, saves[0].attrs["dago.rows"])
+		inserts := tracer.named("dago.insert simple_dao")
+		assert.Len(t, inserts, 1)
+		assert.Equal(t, saves[0], inserts[0].parent)
+	}
+	assert.Equal(t, 1, metrics.written["simple_dao"])
+
+	// batches count the rows of all their statements
+	assert.NoError(t, da.Save(&DenormalizedTx{"ab", "cd", 3, 10}))
+	assert.Equal(t, 2, metrics.written["txs"])
+
+	// rows of partition deletes aren't known
+	assert.NoError(t, da.DeletePartition(&SimpleDao{AString: "foo", SomeBytes: []byte{1}}))
+	if deletes := tracer.named("dago.DeletePartition simple_dao"); assert.Len(t, deletes, 1) {
+		assert.NotContains(t, deletes[0].attrs, "dago.rows")
+	}
+}
+
+func TestInstrumentErrors(t *testing.T) {
+	tracer, metrics, da := newInstrumented(func(st *Statement) ([][]interface{}, error) {
+		return nil, gocql.ErrTimeoutNoResponse
+	})
+	_, err := da.Get(&SimpleDao{AString: "foo", SomeBytes: []byte{1}})
+	assert.True(t, IsTimeout(err))
+	if gets := tracer.named("dago.Get simple_dao"); assert.Len(t, gets, 1) {
+		assert.True(t, gets[0].ended)
+		assert.Equal(t, err, gets[0].err)
+		assert.Equal(t, 0, gets[0].attrs["dago.rows"])
+	}
+	if selects := tracer.named("dago.select simple_dao"); assert.Len(t, selects, 1) {
+		assert.Equal(t, gocql.ErrTimeoutNoResponse, selects[0].err)
+	}
+	assert.Equal(t, 1, metrics.errors[OpSelect])
+
+	// failing before any statement still ends the span
+	assert.Error(t, da.DeleteFields(&SimpleDao{}))
+	if deletes := tracer.named("dago.DeleteFields simple_dao"); assert.Len(t, deletes, 1) {
+		assert.True(t, deletes[0].ended)
+		assert.Error(t, deletes[0].err)
+	}
+}
+
+func TestNotInstrumented(t *testing.T) {
+	da := NewDataAccess(NewCQLHelper(nil))
+	same, span := da.startSpan("Get", OpSelect, &SimpleDao{})
+	assert.Same(t, da, same)
+	assert.Nil(t, span)
+	assert.Equal(t, gocql.ErrNotFound, span.endRow(gocql.ErrNotFound))
+}
@@ -0,0 +1,152 @@
+package dago
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/gocql/gocql"
+)
+
+// Kind of operation performed by a statement
+type Op string
+
+const (
+	OpSelect Op = "select"
+	OpInsert Op = "insert"
+	OpUpdate Op = "update"
+	OpDelete Op = "delete"
+	OpRaw    Op = "raw" // arbitrary statement passed to CQLHelper.QueryIter
+	OpBatch  Op = "batch"
+)
+
+// A statement about to be executed by the CQLHelper, as seen by interceptors. The CQL text
+// and values are informational, options can be changed on the gocql query before it runs.
+type Statement struct {
+	Op    Op
+	Table string
+	CQL   string
+	// Column each bound value is for, empty for raw statements
+	Columns    []string
+	Values     []interface{}
+	Idempotent bool
+	// Type of the DAO the statement was issued for, nil for direct CQLHelper calls
+	DAOType reflect.Type
+	// Query of the statement, nil for batches
+	Query *gocql.Query
+	// Batch and the statements it groups for batches, nil otherwise
+	Batch      *gocql.Batch
+	Statements []*Statement
+
+	redacted map[string]bool
+	session  *gocql.Session
+}
+
+const redactedValue = "<redacted>"
+
+// Bound values safe for display, values of columns tagged with the redact qualifier being
+// masked.
+func (self *Statement) SafeValues() []interface{} {
+	values := make([]interface{}, len(self.Values))
+	for n, val := range self.Values {
+		if n < len(self.Columns) && self.redacted[self.Columns[n]] {
+			values[n] = redactedValue
+		} else {
+			values[n] = val
+		}
+	}
+	return values
+}
+
+// Statement text followed by its safe values, for logs and error messages.
+func (self *Statement) String() string {
+	return self.CQL + " " + fmt.Sprint(self.SafeValues())
+}
+
+// Executes the statement, or hands it over to the next interceptor in the chain.
+type Invoker func(ctx context.Context, st *Statement) Iter
+
+// Called around the execution of every statement by the CQLHelper. An interceptor can
+// inspect the statement, change its query options, wrap the returned iterator or
+// short-circuit execution altogether by returning ErrorIter instead of calling next.
+// Writes run through the same chain, their outcome being the error returned by Close.
+// Interceptors wrapping the iterator should keep exposing MapScan (see MapScanner) for
+// lightweight transactions to work.
+// Example:
+//
+//	db.Use(func(ctx context.Context, st *dago.Statement, next dago.Invoker) dago.Iter {
+//		if readOnly && st.Op != dago.OpSelect {
+//			return dago.ErrorIter(errors.New("read-only mode"))
+//		}
+//		return next(ctx, st)
+//	})
+type Interceptor func(ctx context.Context, st *Statement, next Invoker) Iter
+
+// Iterators able to scan a row into a map, like gocql's.
+type MapScanner interface {
+	MapScan(m map[string]interface{}) bool
+}
+
+type errorIter struct {
+	err error
+}
+
+// Returns an iterator without rows whose Close returns the provided error.
+func ErrorIter(err error) Iter {
+	return &errorIter{err}
+}
+
+func (self *errorIter) Close() error {
+	return self.err
+}
+
+func (self *errorIter) Scan(dest ...interface{}) bool {
+	return false
+}
+
+func (self *errorIter) MapScan(m map[string]interface{}) bool {
+	return false
+}
+
+// Adds interceptors to the chain, the first one being the outermost. Must be called before
+// the helper is used.
+func (self *CQLHelper) Use(interceptors ...Interceptor) {
+	self.interceptors = append(self.interceptors, interceptors...)
+}
+
+// Runs the statement through the interceptors chain.
+func (self *CQLHelper) run(st *Statement) Iter {
+	ctx := self.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if self.consistency != nil {
+		if st.Batch != nil {
+			st.Batch.SetConsistency(*self.consistency)
+		} else {
+			st.Query.Consistency(*self.consistency)
+		}
+	}
+	return self.invoker(0)(ctx, st)
+}
+
+func (self *CQLHelper) invoker(n int) Invoker {
+	if n == len(self.interceptors) {
+		return execute
+	}
+	return func(ctx context.Context, st *Statement) Iter {
+		return self.interceptors[n](ctx, st, self.invoker(n+1))
+	}
+}
+
+// Runs the statement with the context passed down the chain, so interceptors can set
+// deadlines, cancel or add values to it.
+func execute(ctx context.Context, st *Statement) Iter {
+	if err := ctx.Err(); err != nil {
+		return ErrorIter(err)
+	}
+	if st.Batch != nil {
+		return ErrorIter(st.session.ExecuteBatch(st.Batch.WithContext(ctx)))
+	}
+	return st.Query.WithContext(ctx).Iter()
+}
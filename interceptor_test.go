@@ -0,0 +1,141 @@
+package dago
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterceptorChain(t *testing.T) {
+	helper := NewCQLHelper(nil)
+	calls := []string{}
+	helper.Use(
+		func(ctx context.Context, st *Statement, next Invoker) Iter {
+			calls = append(calls, "outer")
+			return next(ctx, st)
+		},
+		func(ctx context.Context, st *Statement, next Invoker) Iter {
+			calls = append(calls, "inner "+st.Table)
+			if st.Op != OpSelect {
+				return ErrorIter(errors.New("read-only"))
+			}
+			return next(ctx, st)
+		})
+
+	err := helper.exec(&Statement{Op: OpDelete, Table: "simple_dao"})
+	assert.EqualError(t, err, "read-only")
+	assert.Equal(t, []string{"outer", "inner simple_dao"}, calls)
+}
+
+func TestInterceptorContext(t *testing.T) {
+	helper := NewCQLHelper(&gocql.Session{})
+	helper.Use(func(ctx context.Context, st *Statement, next Invoker) Iter {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		return next(ctx, st)
+	})
+	// the query isn't sent, the session never connecting
+	_, err := NewDataAccess(helper).Get(&SimpleDao{AString: "foo", SomeBytes: []byte{1}})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, helper.exec(helper.batch("simple_dao")), context.Canceled)
+}
+
+// Records the statements run by a helper whose session never connects, answering them with
+// the rows, or error, returned by answer.
+type recorder struct {
+	mutex      sync.Mutex
+	statements []*Statement
+	answer     func(st *Statement) ([][]interface{}, error)
+}
+
+// Creates a DataAccess whose statements are all recorded, without rows when answer is nil.
+func newRecorder(answer func(st *Statement) ([][]interface{}, error)) (*recorder, *DataAccess) {
+	rec := &recorder{answer: answer}
+	helper := NewCQLHelper(&gocql.Session{})
+	helper.Use(rec.intercept)
+	return rec, NewDataAccess(helper)
+}
+
+func (self *recorder) intercept(ctx context.Context, st *Statement, next Invoker) Iter {
+	self.mutex.Lock()
+	self.statements = append(self.statements, st)
+	self.mutex.Unlock()
+	if self.answer == nil {
+		return &fakeIter{}
+	}
+	rows, err := self.answer(st)
+	return &fakeIter{rows: rows, err: err}
+}
+
+// CQL text of the recorded statements, in order.
+func (self *recorder) CQL() []string {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	cql := make([]string, len(self.statements))
+	for n, st := range self.statements {
+		cql[n] = st.CQL
+	}
+	return cql
+}
+
+// Iterator over canned rows, converting values to the scan destinations types.
+type fakeIter struct {
+	rows [][]interface{}
+	err  error
+}
+
+func (self *fakeIter) Scan(dest ...interface{}) bool {
+	if len(self.rows) == 0 {
+		return false
+	}
+	row := self.rows[0]
+	self.rows = self.rows[1:]
+	for n, d := range dest {
+		v := reflect.ValueOf(d).Elem()
+		if row[n] == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(row[n]).Convert(v.Type()))
+		}
+	}
+	return true
+}
+
+func (self *fakeIter) MapScan(m map[string]interface{}) bool {
+	return false
+}
+
+func (self *fakeIter) Close() error {
+	return self.err
+}
+
+func TestIterVariants(t *testing.T) {
+	rec, da := newRecorder(nil)
+	pk, pk2 := &F{"a", 1}, &F{"b", 2}
+	for _, iter := range []Iter{
+		da.helper.FullScanIter("t", "x", "y"),
+		da.helper.FullScanQuorumIter("t", "x"),
+		da.helper.FetchIter("t", 5, []*F{pk}, "x"),
+		da.helper.ScanIter("t", 5, pk, "x"),
+		da.helper.Scan2Iter("t", 5, pk, pk2, "x"),
+		da.helper.QueryIter("select x from t where a = ?", 1),
+	} {
+		assert.NoError(t, iter.Close())
+	}
+	assert.Equal(t, []string{
+		"select x, y from t",
+		"select x from t",
+		"select x from t where a = ? limit 5",
+		"select x from t where a = ? limit 5",
+		"select x from t where a = ? and b = ? limit 5",
+		"select x from t where a = ?",
+	}, rec.CQL())
+	assert.Equal(t, gocql.Quorum, rec.statements[1].Query.GetConsistency())
+	assert.Equal(t, OpRaw, rec.statements[5].Op)
+	assert.False(t, rec.statements[5].Idempotent)
+}
@@ -0,0 +1,143 @@
+package dago
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/gocql/gocql"
+)
+
+// Column name of the values bound to JSON statements, for redaction
+const jsonColumn = "[json]"
+
+// Saves a row of the table of the provided DAO from a JSON object keyed by the DAO column
+// names, without going through the DAO fields. Values follow the Cassandra JSON encoding,
+// like hex strings prefixed with 0x for blobs. Columns missing from the object are left as
+// is. Secondary tables are written in the same logged batch, their key columns being then
+// required too. Save hooks are called on the provided DAO, which isn't filled from the object.
+// Example:
+//
+//	err := da.SaveJSON(&User{}, json.RawMessage(`{"country": "US", "ssn": "890-123-4567", "name": "Joe"}`))
+func (self *DataAccess) SaveJSON(dao DAOLite, doc json.RawMessage) error {
+	da, span := self.startSpan("SaveJSON", OpInsert, dao)
+	return span.endRow(da.saveJSON(dao, doc))
+}
+
+func (self *DataAccess) saveJSON(dao DAOLite, doc json.RawMessage) error {
+	if err := self.checkWrite(dao); err != nil {
+		return err
+	}
+	var cols map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &cols); err != nil {
+		return err
+	}
+	for _, col := range self.ColNamesOfKind(dao, ANY_KEY) {
+		if _, ok := cols[col]; !ok {
+			return errors.New("dago: missing key column " + col + " in JSON object")
+		}
+	}
+	known := self.ColNamesOfKind(dao, ANY)
+	for col := range cols {
+		if !StringInList(col, known) {
+			return errors.New("dago: unknown column " + col + " in JSON object")
+		}
+	}
+	info := self.denormalized(dao)
+	if info != nil {
+		// secondary keys must be in the object for its rows to be found again by deletes
+		for _, m := range info.Secondary {
+			for _, field := range append(append([]string{}, m.PartitionKeys...), m.ClusteringKeys...) {
+				col := info.column(field).Column
+				if _, ok := cols[col]; !ok {
+					return errors.New("dago: missing key column " + col + " of secondary table " + m.Table + " in JSON object")
+				}
+			}
+		}
+	}
+	if err := self.beforeSave(dao); err != nil {
+		return err
+	}
+	// keys are only in the object, dropping the whole table is simpler than decoding them
+	defer self.uncacheRange(self.tableOf(dao), dao, nil)
+	helper := self.jsonHelperFor(dao)
+	var res error
+	if info != nil {
+		table := self.tableOf(dao)
+		stmts := []*Statement{helper.saveJSON(table, doc)}
+		for _, m := range info.Secondary {
+			stmts = append(stmts, helper.saveJSON(self.qualify(m.Table, info.Keyspace), doc))
+		}
+		res = helper.exec(helper.batch(table, stmts...))
+	} else {
+		res = helper.SaveJSON(self.tableOf(dao), doc)
+	}
+	self.afterSave(dao, res)
+	return res
+}
+
+// Gets the row of the provided DAO, which is expected to have values for its keys, as a JSON
+// object keyed by column names. The DAO is left as is.
+// Example:
+//
+//	doc, err := da.GetJSON(&User{Country: "US", SSN: "890-123-4567"})
+func (self *DataAccess) GetJSON(dao DAOLite) (json.RawMessage, error) {
+	if err := self.check(dao); err != nil {
+		return nil, err
+	}
+	helper := self.jsonHelperFor(dao)
+	iter := helper.run(helper.getNJSON(self.tableOf(dao), self.Keys(dao), "", self.ColNamesOfKind(dao, ANY)))
+	var doc string
+	found := iter.Scan(&doc)
+	if err := iter.Close(); err != nil {
+		return nil, classify(err)
+	}
+	if !found {
+		return nil, gocql.ErrNotFound
+	}
+	return json.RawMessage(doc), nil
+}
+
+// Same as PartitionIter but rows are JSON objects keyed by column names, see ScanJSON.
+// Example:
+//
+//	iter := da.PartitionIterJSON(&User{Country: "US", State: "CA"})
+//	for doc, ok := dago.ScanJSON(iter); ok; doc, ok = dago.ScanJSON(iter) {...}
+//	err := iter.Close()
+func (self *DataAccess) PartitionIterJSON(dao DAOLite) Iter {
+	if err := self.check(dao); err != nil {
+		return ErrorIter(err)
+	}
+	helper := self.jsonHelperFor(dao)
+	return helper.iter(helper.getNJSON(self.tableOf(dao), self.PartitionKeys(dao), "", self.ColNamesOfKind(dao, ANY)))
+}
+
+// Same as FullIter but rows are JSON objects keyed by column names, see ScanJSON.
+func (self *DataAccess) FullIterJSON(dao DAOLite) Iter {
+	if err := self.check(dao); err != nil {
+		return ErrorIter(err)
+	}
+	return self.jsonHelperFor(dao).FullScanJSON(self.tableOf(dao), self.ColNamesOfKind(dao, ANY)...)
+}
+
+// Next row of an iterator over JSON rows.
+func ScanJSON(iter Iter) (json.RawMessage, bool) {
+	var doc string
+	if !iter.Scan(&doc) {
+		return nil, false
+	}
+	return json.RawMessage(doc), true
+}
+
+// Helper for the DAO masking whole JSON values when some of its columns are redacted.
+func (self *DataAccess) jsonHelperFor(dao DAOLite) *CQLHelper {
+	helper := self.helperFor(dao)
+	if len(helper.redacted) > 0 {
+		redacted := make(map[string]bool, len(helper.redacted)+1)
+		for col := range helper.redacted {
+			redacted[col] = true
+		}
+		redacted[jsonColumn] = true
+		helper.redacted = redacted
+	}
+	return helper
+}
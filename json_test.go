@@ -0,0 +1,23 @@
+package dago
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveJSONValidation(t *testing.T) {
+	da := NewDataAccess(NewCQLHelper(nil))
+	assert.EqualError(t, da.SaveJSON(&RedactedDao{}, json.RawMessage(`{"country": "US", "name": "Joe"}`)),
+		"dago: missing key column ssn in JSON object")
+	assert.EqualError(t, da.SaveJSON(&RedactedDao{}, json.RawMessage(`{"country": "US", "ssn": "1", "age": 7}`)),
+		"dago: unknown column age in JSON object")
+	assert.Error(t, da.SaveJSON(&RedactedDao{}, json.RawMessage(`[]`)))
+
+	// the whole object is masked when a column is redacted
+	helper := da.jsonHelperFor(&RedactedDao{})
+	st := &Statement{Columns: []string{jsonColumn}, Values: []interface{}{`{"ssn": "890-123-4567"}`}, redacted: helper.redacted}
+	assert.Equal(t, []interface{}{"<redacted>"}, st.SafeValues())
+	assert.False(t, da.jsonHelperFor(&SimpleDao{}).redacted[jsonColumn])
+}
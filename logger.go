@@ -0,0 +1,77 @@
+package dago
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Logs every statement executed through the CassandraDb with its CQL text, bound values
+// and outcome. Successful statements are logged at debug level and failed ones at warn
+// level. Values of columns tagged with the redact qualifier are masked.
+// Example:
+//
+//	type User struct {
+//		Country string `column:"country,key"`
+//		SSN     string `column:"ssn,sort,redact"`
+//	}
+//	db, err := dago.OpenWithOptions("users", hosts, dago.WithLogger(slog.Default()))
+func WithLogger(logger *slog.Logger) Option {
+	return func(db *CassandraDb) {
+		db.Use(queryLogger(logger))
+	}
+}
+
+func queryLogger(logger *slog.Logger) Interceptor {
+	return func(ctx context.Context, st *Statement, next Invoker) Iter {
+		return &loggedIter{next(ctx, st), ctx, st, logger, time.Now(), 0}
+	}
+}
+
+// Logs the statement once its iterator is closed.
+type loggedIter struct {
+	Iter
+	ctx    context.Context
+	st     *Statement
+	logger *slog.Logger
+	start  time.Time
+	rows   int
+}
+
+func (self *loggedIter) Scan(dest ...interface{}) bool {
+	if self.Iter.Scan(dest...) {
+		self.rows++
+		return true
+	}
+	return false
+}
+
+func (self *loggedIter) MapScan(m map[string]interface{}) bool {
+	if ms, ok := self.Iter.(MapScanner); ok && ms.MapScan(m) {
+		self.rows++
+		return true
+	}
+	return false
+}
+
+func (self *loggedIter) Close() error {
+	err := self.Iter.Close()
+	attrs := []slog.Attr{
+		slog.String("op", string(self.st.Op)),
+		slog.String("table", self.st.Table),
+		slog.String("cql", self.st.CQL),
+		slog.Any("values", self.st.SafeValues()),
+		slog.Duration("duration", time.Since(self.start)),
+		slog.Int("rows", self.rows),
+	}
+	if self.st.DAOType != nil {
+		attrs = append(attrs, slog.String("dao", self.st.DAOType.String()))
+	}
+	level := slog.LevelDebug
+	if err != nil {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	self.logger.LogAttrs(self.ctx, level, "dago query", attrs...)
+	return err
+}
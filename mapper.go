@@ -0,0 +1,55 @@
+package dago
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Reflection free access to the fields of a DAO type, usually generated with dagogen. Once
+// registered with RegisterMapper, DataAccess uses it instead of reflection to bind and scan
+// field values.
+type Mapper interface {
+	// Column names of all fields, in the same order as their definition in the struct. Used
+	// to detect mappers that were generated before the struct was changed.
+	Columns() []string
+	// Value to bind in statements for the named field
+	Value(dao interface{}, field string) interface{}
+	// Scan destination for the named field, pointing into the DAO
+	Dest(dao interface{}, field string) interface{}
+}
+
+type mapperEntry struct {
+	mapper Mapper
+	once   sync.Once
+	valid  bool
+}
+
+var mappers sync.Map // reflect.Type to *mapperEntry
+
+// Registers the mapper for the type of the provided DAO, typically from the init function
+// of generated code.
+func RegisterMapper(dao DAOLite, mapper Mapper) {
+	mappers.Store(reflect.TypeOf(dao), &mapperEntry{mapper: mapper})
+}
+
+// Mapper registered for the type of the DAO if any and matching its current definition,
+// nil otherwise in which case reflection must be used.
+func mapperFor(dao interface{}) Mapper {
+	e, ok := mappers.Load(reflect.TypeOf(dao))
+	if !ok {
+		return nil
+	}
+	entry := e.(*mapperEntry)
+	entry.once.Do(func() {
+		defs, err := daoFieldDefs(dao)
+		cols := entry.mapper.Columns()
+		entry.valid = err == nil && len(cols) == len(defs)
+		for n := 0; entry.valid && n < len(defs); n++ {
+			entry.valid = cols[n] == defs[n].col
+		}
+	})
+	if !entry.valid {
+		return nil
+	}
+	return entry.mapper
+}
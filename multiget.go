@@ -0,0 +1,198 @@
+package dago
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Gets many DAOs by primary key at once, each DAO being updated in place like with Get. The
+// returned slice tells, in input order, which DAOs were found. A missing row isn't an error,
+// only query failures are.
+//
+// When all DAOs are of the same type and only differ by their last partition key, a single
+// IN query is issued. Otherwise each row is fetched separately, running at most the
+// DataAccess concurrency (see SetConcurrency) queries at a time.
+// Example:
+//
+//	outs := []DAOLite{&Output{TxHash: h, Index: 0}, &Output{TxHash: h, Index: 1}}
+//	found, err := da.GetMany(outs)
+func (self *DataAccess) GetMany(daos []DAOLite) ([]bool, error) {
+	da, span := self.startSpan("GetMany", OpSelect, first(daos))
+	found, err := da.getMany(daos)
+	rows := 0
+	for _, ok := range found {
+		if ok {
+			rows++
+		}
+	}
+	return found, span.end(err, rows)
+}
+
+func (self *DataAccess) getMany(daos []DAOLite) ([]bool, error) {
+	if len(daos) == 0 {
+		return []bool{}, nil
+	}
+	for _, dao := range daos {
+		if err := self.check(dao); err != nil {
+			return nil, err
+		}
+	}
+	if in, ok := self.inColumn(daos); ok {
+		return self.getManyIn(daos, in)
+	}
+	return self.getManyParallel(daos)
+}
+
+// Checks whether the provided DAOs can be fetched with a single IN query, returning the
+// name of the field to use in the IN clause.
+func (self *DataAccess) inColumn(daos []DAOLite) (string, bool) {
+	if len(daos) < 2 {
+		return "", false
+	}
+	first := daos[0]
+	partNames := self.FieldNamesOfKind(first, PARTITION_KEY)
+	if len(partNames) == 0 {
+		return "", false
+	}
+	in := partNames[len(partNames)-1]
+	t := reflect.TypeOf(first)
+	others := self.keysExcept(first, in)
+	for _, dao := range daos[1:] {
+		if reflect.TypeOf(dao) != t || self.tableOf(dao) != self.tableOf(first) {
+			return "", false
+		}
+		if !reflect.DeepEqual(self.keysExcept(dao, in), others) {
+			return "", false
+		}
+	}
+	return in, true
+}
+
+// Primary keys values filters for the provided DAO, excluding the given field.
+func (self *DataAccess) keysExcept(dao DAOLite, field string) []*F {
+	names := self.FieldNamesOfKind(dao, ANY_KEY)
+	keys := self.Keys(dao)
+	filtered := make([]*F, 0, len(keys))
+	for n, key := range keys {
+		if names[n] != field {
+			filtered = append(filtered, key)
+		}
+	}
+	return filtered
+}
+
+func (self *DataAccess) getManyIn(daos []DAOLite, in string) ([]bool, error) {
+	first := daos[0]
+	inCol := self.fieldDef(first, in).col
+
+	// several DAOs may ask for the same row
+	type inValue struct {
+		key  interface{}
+		daos []int
+	}
+	byValue := make([]*inValue, 0, len(daos))
+	inValues := make([]interface{}, 0, len(daos))
+	for n, dao := range daos {
+		fields, err := self.fieldsOfKind(dao, PARTITION_KEY, []string{in})
+		if err != nil {
+			return nil, err
+		}
+		val := fields[0].Value
+		key := normalizeKey(val)
+		found := false
+		for _, iv := range byValue {
+			if reflect.DeepEqual(iv.key, key) {
+				iv.daos = append(iv.daos, n)
+				found = true
+				break
+			}
+		}
+		if !found {
+			byValue = append(byValue, &inValue{key, []int{n}})
+			inValues = append(inValues, val)
+		}
+	}
+
+	colsToGet := append(self.ColNamesOfKind(first, NON_KEY), inCol)
+	fieldsToGet := append(self.FieldNamesOfKind(first, NON_KEY), in)
+	helper := self.helperFor(first)
+	iter := helper.iter(helper.getNIn(self.tableOf(first), self.keysExcept(first, in), inCol, inValues, colsToGet))
+
+	found := make([]bool, len(daos))
+	var hookErr error
+	for hookErr == nil {
+		values := self.fieldsZeroValuesArray(first, fieldsToGet)
+		if !iter.Scan(values...) {
+			break
+		}
+		key := normalizeKey(reflect.ValueOf(values[len(values)-1]).Elem().Interface())
+		for _, iv := range byValue {
+			if !reflect.DeepEqual(iv.key, key) {
+				continue
+			}
+			for _, n := range iv.daos {
+				err := self.setFieldsValues(daos[n], fieldsToGet, values)
+				if err == nil {
+					err = self.afterLoad(daos[n])
+				}
+				if err != nil {
+					hookErr = err
+					break
+				}
+				found[n] = true
+			}
+			break
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, classify(err)
+	}
+	if hookErr != nil {
+		return nil, hookErr
+	}
+	return found, nil
+}
+
+// Key value as it's stored, so that a value read back compares equal to the bound one with
+// reflect.DeepEqual: named types are bound as their basic type, and times are in UTC with
+// the millisecond precision of timestamps and no monotonic clock reading.
+func normalizeKey(val interface{}) interface{} {
+	if val == nil {
+		return nil
+	}
+	val = bindValue(reflect.ValueOf(val))
+	if t, ok := val.(time.Time); ok {
+		return t.UTC().Truncate(time.Millisecond)
+	}
+	return val
+}
+
+func (self *DataAccess) getManyParallel(daos []DAOLite) ([]bool, error) {
+	found := make([]bool, len(daos))
+	errs := make([]error, len(daos))
+	sem := make(chan struct{}, self.concurrency)
+	var wg sync.WaitGroup
+
+	for n, dao := range daos {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(n int, dao DAOLite) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			_, err := self.Get(dao)
+			found[n] = err == nil
+			errs[n] = ENF(err)
+		}(n, dao)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
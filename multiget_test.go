@@ -0,0 +1,93 @@
+package dago
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInColumn(t *testing.T) {
+	da := NewDataAccess(nil)
+	s1 := &SimpleDao{AString: "foo", SomeBytes: []byte{1}, ABigUInt: 1, AnInt: 2}
+	s2 := &SimpleDao{AString: "foo", SomeBytes: []byte{2}, ABigUInt: 1, AnInt: 2}
+	s3 := &SimpleDao{AString: "bar", SomeBytes: []byte{3}, ABigUInt: 1, AnInt: 2}
+
+	in, ok := da.inColumn([]DAOLite{s1, s2})
+	assert.True(t, ok)
+	assert.Equal(t, "SomeBytes", in)
+
+	_, ok = da.inColumn([]DAOLite{s1, s2, s3})
+	assert.False(t, ok)
+	_, ok = da.inColumn([]DAOLite{s1})
+	assert.False(t, ok)
+}
+
+type DailyValue struct {
+	Series string    `column:"series,key"`
+	Day    time.Time `column:"day,key"`
+	Value  int64     `column:"value"`
+}
+
+func (self *DailyValue) TableName() string {
+	return "daily_values"
+}
+
+func TestGetManyIn(t *testing.T) {
+	local := time.FixedZone("UTC+2", 2*3600)
+	day1 := time.Now().In(local) // with a monotonic clock reading
+	day2 := day1.Add(24 * time.Hour)
+	rec, da := newRecorder(func(st *Statement) ([][]interface{}, error) {
+		// as read back, in UTC with millisecond precision
+		return [][]interface{}{
+			{int64(2), day2.UTC().Truncate(time.Millisecond)},
+			{int64(1), day1.UTC().Truncate(time.Millisecond)},
+		}, nil
+	})
+	daos := []DAOLite{
+		&DailyValue{Series: "fees", Day: day1},
+		&DailyValue{Series: "fees", Day: day2},
+		&DailyValue{Series: "fees", Day: day2.Add(24 * time.Hour)},
+		&DailyValue{Series: "fees", Day: day1},
+	}
+	found, err := da.GetMany(daos)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, true, false, true}, found)
+	assert.Equal(t, int64(1), daos[0].(*DailyValue).Value)
+	assert.Equal(t, int64(2), daos[1].(*DailyValue).Value)
+	assert.Equal(t, int64(1), daos[3].(*DailyValue).Value)
+	// a single query, duplicates asked once
+	if assert.Len(t, rec.statements, 1) {
+		assert.Equal(t, "select value, day from daily_values where series = ? and day in ?", rec.statements[0].CQL)
+		assert.Len(t, rec.statements[0].Values[1], 3)
+	}
+}
+
+func TestGetManyParallel(t *testing.T) {
+	rec, da := newRecorder(func(st *Statement) ([][]interface{}, error) {
+		if st.Values[0] == "foo" {
+			return [][]interface{}{{time.Unix(42, 0), big.NewInt(42), true}}, nil
+		}
+		return nil, nil
+	})
+	daos := []DAOLite{
+		&SimpleDao{AString: "foo", SomeBytes: []byte{1}},
+		&SimpleDao{AString: "bar", SomeBytes: []byte{2}},
+		&SimpleDao{AString: "foo", SomeBytes: []byte{1}},
+	}
+	found, err := da.GetMany(daos)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, false, true}, found)
+	assert.True(t, daos[0].(*SimpleDao).ABool)
+	assert.Equal(t, big.NewInt(42), daos[2].(*SimpleDao).ABigInt)
+	assert.Len(t, rec.statements, 3)
+
+	_, da = newRecorder(func(st *Statement) ([][]interface{}, error) {
+		return nil, gocql.ErrTimeoutNoResponse
+	})
+	_, err = da.GetMany(daos)
+	assert.True(t, IsTimeout(err))
+}
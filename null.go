@@ -0,0 +1,94 @@
+package dago
+
+import (
+	"reflect"
+
+	"github.com/gocql/gocql"
+)
+
+// Optional value of a DAO field, telling NULL columns apart from zero values, which plain
+// fields can't. Pointer fields do the same, being nil for NULL columns.
+// Example:
+//
+//	type Block struct {
+//		Hash string           `column:"hash,key"`
+//		Fees dago.Null[int64] `column:"fees,omitempty"`
+//	}
+type Null[T any] struct {
+	V     T
+	Valid bool // false for NULL
+}
+
+// Null holding the provided value.
+func NullOf[T any](v T) Null[T] {
+	return Null[T]{v, true}
+}
+
+func (self Null[T]) MarshalCQL(info gocql.TypeInfo) ([]byte, error) {
+	if !self.Valid {
+		return nil, nil
+	}
+	return gocql.Marshal(info, bindValue(reflect.ValueOf(self.V)))
+}
+
+func (self *Null[T]) UnmarshalCQL(info gocql.TypeInfo, data []byte) error {
+	var zero T
+	self.V, self.Valid = zero, data != nil
+	if data == nil {
+		return nil
+	}
+	return gocql.Unmarshal(info, data, &self.V)
+}
+
+// Implemented by all Null types, telling NULL values apart whatever the value they hold.
+type nullable interface {
+	isNull() bool
+}
+
+func (self Null[T]) isNull() bool {
+	return !self.Valid
+}
+
+// Tells whether a field value is left out of writes by the omitempty qualifier: zero values,
+// nil pointers, invalid Nulls and empty slices and maps.
+func isEmpty(v reflect.Value) bool {
+	if null, ok := v.Interface().(nullable); ok {
+		return null.isNull()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// Fields written when saving the DAO, all keys and the named non key fields, all of them
+// when none. Empty values of omitempty fields are left out, or bound as unset, see
+// SetUnsetEmpty.
+func (self *DataAccess) saveFields(dao DAOLite, names []string) ([]*F, error) {
+	if err := self.check(dao); err != nil {
+		return nil, err
+	}
+	mapper := self.mapperFor(dao)
+	v := reflect.ValueOf(dao).Elem()
+	defs := self.initFieldsDefs(dao)
+	fields := make([]*F, 0, len(defs))
+	for _, fdef := range defs {
+		if fdef.kind == NON_KEY && len(names) > 0 && !StringInList(fdef.name, names) {
+			continue
+		}
+		// fields are only reflected on when needed, mappers avoiding it
+		if fdef.kind == NON_KEY && fdef.omitEmpty && isEmpty(v.FieldByName(fdef.name)) {
+			if self.unsetEmpty {
+				fields = append(fields, &F{fdef.col, gocql.UnsetValue})
+			}
+			continue
+		}
+		if mapper != nil {
+			fields = append(fields, &F{fdef.col, mapper.Value(dao, fdef.name)})
+		} else {
+			fields = append(fields, &F{fdef.col, self.bind(v.FieldByName(fdef.name))})
+		}
+	}
+	return fields, nil
+}
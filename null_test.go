@@ -0,0 +1,94 @@
+package dago
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+type OptionalDao struct {
+	Hash  string      `column:"hash,key"`
+	Fees  Null[int64] `column:"fees,omitempty"`
+	Size  *int        `column:"size"`
+	Txs   []string    `column:"txs,omitempty"`
+	Miner string      `column:"miner,omitempty"`
+}
+
+func (self *OptionalDao) TableName() string {
+	return "optional_dao"
+}
+
+func TestOmitEmpty(t *testing.T) {
+	da := NewDataAccess(NewCQLHelper(nil))
+	block := &OptionalDao{Hash: "00ab", Fees: NullOf(int64(0))}
+	fields, err := da.saveFields(block, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []*F{{"hash", "00ab"}, {"fees", NullOf(int64(0))}, {"size", (*int)(nil)}}, fields)
+	fields, _ = da.saveFields(block, []string{"Txs", "Miner"})
+	assert.Equal(t, []*F{{"hash", "00ab"}}, fields)
+
+	da.SetUnsetEmpty(true)
+	fields, _ = da.saveFields(block, []string{"Txs"})
+	assert.Equal(t, []*F{{"hash", "00ab"}, {"txs", gocql.UnsetValue}}, fields)
+
+	// invalid Nulls are empty whatever the value they hold
+	block.Fees = Null[int64]{V: 5, Valid: false}
+	fields, _ = da.saveFields(block, []string{"Fees"})
+	assert.Equal(t, []*F{{"hash", "00ab"}, {"fees", gocql.UnsetValue}}, fields)
+	assert.True(t, isEmpty(reflect.ValueOf(Null[int64]{V: 5})))
+	assert.False(t, isEmpty(reflect.ValueOf(NullOf(int64(0)))))
+
+	assert.Equal(t, "bigint", CQLTypeOf(reflect.TypeOf(block.Fees)))
+}
+
+type MappedDao struct {
+	Hash  string `column:"hash,key"`
+	Miner string `column:"miner,omitempty"`
+	Size  int    `column:"size"`
+}
+
+func (self *MappedDao) TableName() string {
+	return "mapped_dao"
+}
+
+// Binds field names rather than values, to tell them from reflected ones.
+type namesMapper struct{}
+
+func (namesMapper) Columns() []string {
+	return []string{"hash", "miner", "size"}
+}
+
+func (namesMapper) Value(dao interface{}, field string) interface{} {
+	return field
+}
+
+func (namesMapper) Dest(dao interface{}, field string) interface{} {
+	return nil
+}
+
+func TestOmitEmptyMapped(t *testing.T) {
+	RegisterMapper(&MappedDao{}, namesMapper{})
+	da := NewDataAccess(NewCQLHelper(nil))
+	fields, err := da.saveFields(&MappedDao{Hash: "00ab", Size: 3}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []*F{{"hash", "Hash"}, {"size", "Size"}}, fields)
+	fields, _ = da.saveFields(&MappedDao{Hash: "00ab", Miner: "f2pool"}, nil)
+	assert.Equal(t, []*F{{"hash", "Hash"}, {"miner", "Miner"}, {"size", "Size"}}, fields)
+}
+
+func TestNull(t *testing.T) {
+	info := gocql.NewNativeType(4, gocql.TypeBigInt, "")
+	data, err := gocql.Marshal(info, Null[int]{})
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+
+	data, err = gocql.Marshal(info, NullOf(42))
+	assert.NoError(t, err)
+	n := NullOf(1)
+	assert.NoError(t, gocql.Unmarshal(info, data, &n))
+	assert.Equal(t, NullOf(42), n)
+	assert.NoError(t, gocql.Unmarshal(info, nil, &n))
+	assert.Equal(t, Null[int]{}, n)
+}
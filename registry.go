@@ -0,0 +1,289 @@
+package dago
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Metadata of a DAO type, computed once and held by a Registry.
+type DAOInfo struct {
+	Type reflect.Type
+	// Table overriding the one returned by TableName when not empty
+	Table string
+	// Keyspace of the table, the session's one when empty
+	Keyspace string
+	Columns  []*ColumnInfo
+	// Time to live of saved rows, none when zero
+	TTL time.Duration
+	// Time rows stay in the cache of a DataAccess, not cached when zero, see WithCache
+	CacheTTL time.Duration
+	// Consistency of all statements for the DAO, overriding the DataAccess defaults
+	Consistency *gocql.Consistency
+	// Clustering key field holding the block height, for rollbacks
+	HeightField string
+	// Table rows removed by rollbacks are copied to first, none when empty
+	OrphanTable string
+	// Other tables the DAO is denormalized into, see DAOSecondaryTables
+	Secondary []*TableMapping
+	// Table the DAO reads through a materialized view of, empty when bound to a table, see
+	// DAOView
+	BaseTable string
+
+	defs     []*fieldDef
+	redacted map[string]bool
+	err      error
+	registry *Registry
+}
+
+// Persisted field of a DAO.
+type ColumnInfo struct {
+	Field     string
+	Column    string
+	Kind      colKind
+	Type      reflect.Type
+	Redact    bool
+	OmitEmpty bool
+	// Class of the secondary index on the column, see IndexSchema, empty when not indexed
+	Index string
+}
+
+// Options set when registering a DAO type.
+type DAOOption func(*DAOInfo)
+
+func WithTable(table string) DAOOption {
+	return func(info *DAOInfo) {
+		info.Table = table
+	}
+}
+
+func WithKeyspace(keyspace string) DAOOption {
+	return func(info *DAOInfo) {
+		info.Keyspace = keyspace
+	}
+}
+
+func WithTTL(ttl time.Duration) DAOOption {
+	return func(info *DAOInfo) {
+		info.TTL = ttl
+	}
+}
+
+func WithConsistency(cons gocql.Consistency) DAOOption {
+	return func(info *DAOInfo) {
+		info.Consistency = &cons
+	}
+}
+
+// Designates the first clustering key field, holding the block height of rows, so they can be
+// rolled back on chain reorganizations, optionally copying them to an orphan table with the
+// same columns first. Not supported for DAOs with secondary tables. See DataAccess.Rollback.
+func WithHeight(field, orphanTable string) DAOOption {
+	return func(info *DAOInfo) {
+		info.HeightField = field
+		info.OrphanTable = orphanTable
+	}
+}
+
+// Names of the key columns, partition keys first.
+func (self *DAOInfo) KeyColumns() []string {
+	return append(self.columnsOfKind(PARTITION_KEY), self.columnsOfKind(CLUSTERING_KEY)...)
+}
+
+func (self *DAOInfo) PartitionKeyColumns() []string {
+	return self.columnsOfKind(PARTITION_KEY)
+}
+
+func (self *DAOInfo) ClusteringKeyColumns() []string {
+	return self.columnsOfKind(CLUSTERING_KEY)
+}
+
+func (self *DAOInfo) columnsOfKind(kind colKind) []string {
+	cols := make([]string, 0, len(self.Columns))
+	for _, col := range self.Columns {
+		if col.Kind == kind {
+			cols = append(cols, col.Column)
+		}
+	}
+	return cols
+}
+
+// Column of the named field, nil if not persisted.
+func (self *DAOInfo) column(field string) *ColumnInfo {
+	for _, col := range self.Columns {
+		if col.Field == field {
+			return col
+		}
+	}
+	return nil
+}
+
+// Table name for the provided DAO, not qualified with the keyspace.
+func (self *DAOInfo) tableFor(dao DAOLite) string {
+	if self.Table != "" {
+		return self.Table
+	}
+	return dao.TableName()
+}
+
+// Table, or view, definition derived from the DAO type, for schema tools. The table name
+// comes from the provided DAO unless overridden when registering.
+func (self *DAOInfo) Schema(dao DAOLite) *TableSchema {
+	table := &TableSchema{Keyspace: self.Keyspace, Name: self.tableFor(dao), Base: self.BaseTable}
+	for _, kind := range []colKind{PARTITION_KEY, CLUSTERING_KEY, NON_KEY} {
+		for _, col := range self.Columns {
+			if col.Kind == kind {
+				typ := CQLTypeOf(col.Type)
+				if codec := self.registry.codec(col.Type); codec != nil {
+					typ = codec.CQLType()
+				}
+				table.Columns = append(table.Columns, &ColumnSchema{col.Column, typ, col.Kind})
+			}
+		}
+	}
+	for _, col := range self.Columns {
+		if col.Index != "" {
+			table.Indexes = append(table.Indexes, &IndexSchema{indexName(table.Name, col.Column), col.Column, col.Index})
+		}
+	}
+	return table
+}
+
+// Checks the DAO type against the definition of its table: all its columns must exist, with
+// the same key layout and a type able to hold the values of their fields.
+func (self *DAOInfo) Check(table *TableSchema) error {
+	errs := make([]error, 0)
+	keys := 0
+	for _, col := range self.Columns {
+		colSchema := table.Column(col.Column)
+		if colSchema == nil {
+			errs = append(errs, &DefinitionError{self.Type, col.Field, "no column " + col.Column + " in table " + table.Name})
+			continue
+		}
+		if colSchema.Kind != col.Kind {
+			errs = append(errs, &DefinitionError{self.Type, col.Field, "key qualifier doesn't match column " + col.Column})
+		}
+		if col.Kind != NON_KEY {
+			keys++
+		}
+		t := col.Type
+		if codec := self.registry.codec(t); codec != nil {
+			t = codec.StoredType()
+		}
+		if err := checkCQLType(t, colSchema.Type); err != nil {
+			errs = append(errs, &DefinitionError{self.Type, col.Field, "column " + col.Column + ": " + err.Error()})
+		}
+	}
+	if want := len(table.PartitionKeys()) + len(table.ClusteringKeys()); keys != want {
+		errs = append(errs, &DefinitionError{self.Type, "", "table " + table.Name + " has " + strconv.Itoa(want) +
+			" key columns, not " + strconv.Itoa(keys)})
+	}
+	return errors.Join(errs...)
+}
+
+// Holds the metadata of all DAO types used by a DataAccess, keyed by their type, and the
+// codecs of field types. DAO types are registered automatically when first used, or
+// explicitly to set options.
+type Registry struct {
+	mutex  sync.RWMutex
+	infos  map[reflect.Type]*DAOInfo
+	codecs map[reflect.Type]Codec
+	// keyspace.table.column of columns known to be indexed, see DataAccess.FindBy
+	indexes map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{infos: make(map[reflect.Type]*DAOInfo)}
+}
+
+// Registers the type of the provided DAO, replacing any previous registration. Returns its
+// metadata, or an error when its definition is invalid.
+// Example:
+//
+//	info, err := da.Registry().Register(&Mempool{}, dago.WithTTL(24*time.Hour))
+func (self *Registry) Register(dao DAOLite, opts ...DAOOption) (*DAOInfo, error) {
+	info := newDAOInfo(dao)
+	info.registry = self
+	for _, opt := range opts {
+		opt(info)
+	}
+	if info.err == nil && info.HeightField != "" {
+		// rollbacks remove rows above the height with a range tombstone, only possible on the
+		// first clustering column
+		clustering := info.columnsOfKind(CLUSTERING_KEY)
+		if len(info.Secondary) > 0 {
+			info.err = &DefinitionError{info.Type, info.HeightField, "height field not supported with secondary tables"}
+		} else if col := info.column(info.HeightField); col == nil || col.Kind != CLUSTERING_KEY || clustering[0] != col.Column {
+			info.err = &DefinitionError{info.Type, info.HeightField, "height field must be the first clustering key"}
+		}
+	}
+	self.mutex.Lock()
+	self.infos[info.Type] = info
+	self.mutex.Unlock()
+	return info, info.err
+}
+
+// Metadata of the DAO type, registering it if needed.
+func (self *Registry) Lookup(dao interface{}) (*DAOInfo, error) {
+	t := reflect.TypeOf(dao)
+	self.mutex.RLock()
+	info := self.infos[t]
+	self.mutex.RUnlock()
+	if info == nil {
+		info = newDAOInfo(dao)
+		info.registry = self
+		self.mutex.Lock()
+		if existing := self.infos[t]; existing != nil {
+			info = existing
+		} else {
+			self.infos[t] = info
+		}
+		self.mutex.Unlock()
+	}
+	if info.err != nil {
+		return nil, info.err
+	}
+	return info, nil
+}
+
+// Metadata of all valid DAO types known to the registry, sorted by type name.
+func (self *Registry) List() []*DAOInfo {
+	self.mutex.RLock()
+	infos := make([]*DAOInfo, 0, len(self.infos))
+	for _, info := range self.infos {
+		if info.err == nil {
+			infos = append(infos, info)
+		}
+	}
+	self.mutex.RUnlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Type.String() < infos[j].Type.String() })
+	return infos
+}
+
+func newDAOInfo(dao interface{}) *DAOInfo {
+	t := reflect.TypeOf(dao)
+	info := &DAOInfo{Type: t}
+	info.defs, info.err = daoFieldDefs(dao)
+	for _, fdef := range info.defs {
+		sf, _ := t.Elem().FieldByName(fdef.name)
+		info.Columns = append(info.Columns, &ColumnInfo{fdef.name, fdef.col, fdef.kind, sf.Type, fdef.redact, fdef.omitEmpty, fdef.index})
+		if fdef.redact {
+			if info.redacted == nil {
+				info.redacted = make(map[string]bool)
+			}
+			info.redacted[fdef.col] = true
+		}
+	}
+	if info.err == nil {
+		info.err = secondaryTables(info, dao)
+	}
+	if info.err == nil {
+		info.err = viewOf(info, dao)
+	}
+	return info
+}
@@ -0,0 +1,64 @@
+package dago
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	da := NewDataAccess(NewCQLHelper(nil))
+	info, err := da.Registry().Register(&SimpleDao{}, WithTable("simple"), WithKeyspace("test"),
+		WithTTL(time.Hour), WithConsistency(gocql.One))
+	assert.NoError(t, err)
+	assert.Equal(t, reflect.TypeOf(&SimpleDao{}), info.Type)
+	assert.Equal(t, []string{"astring", "some_bytes"}, info.PartitionKeyColumns())
+	assert.Equal(t, []string{"astring", "some_bytes", "abigint", "anint"}, info.KeyColumns())
+	assert.Equal(t, "test.simple", da.tableOf(&SimpleDao{}))
+	assert.Equal(t, time.Hour, da.helperFor(&SimpleDao{}).ttl)
+
+	// lookups register automatically, without options
+	assert.Equal(t, "redacted_dao", da.tableOf(&RedactedDao{}))
+	assert.Len(t, da.Registry().List(), 2)
+
+	schema := info.Schema(&SimpleDao{})
+	assert.Equal(t, "simple", schema.Name)
+	types := make([]string, 0, len(schema.Columns))
+	for _, col := range schema.Columns {
+		types = append(types, col.Type)
+	}
+	// uint64 values only fit in varints
+	assert.Equal(t, []string{"text", "blob", "varint", "bigint", "timestamp", "varint", "boolean"}, types)
+
+	_, err = da.Registry().Register(&NoKeyDao{})
+	assert.Error(t, err)
+	assert.Len(t, da.Registry().List(), 2)
+}
+
+func TestCQLTypeOf(t *testing.T) {
+	assert.Equal(t, "map<text, frozen<list<int>>>", CQLTypeOf(reflect.TypeOf(map[string][]int32{})))
+	assert.Equal(t, "list<uuid>", CQLTypeOf(reflect.TypeOf([]gocql.UUID{})))
+	assert.Equal(t, "", CQLTypeOf(reflect.TypeOf(struct{}{})))
+	assert.Equal(t, "smallint", CQLTypeOf(reflect.TypeOf(uint8(0))))
+	assert.Equal(t, "int", CQLTypeOf(reflect.TypeOf(uint16(0))))
+	assert.Equal(t, "bigint", CQLTypeOf(reflect.TypeOf(uint32(0))))
+	assert.Equal(t, "varint", CQLTypeOf(reflect.TypeOf(uint(0))))
+	assert.Equal(t, "", CQLTypeOf(reflect.TypeOf([4]byte{})))
+}
+
+// Tables generated from DAOs must pass their check.
+func TestSchemaCheckRoundTrip(t *testing.T) {
+	daos := []DAOLite{&SimpleDao{}, &RedactedDao{}, &CachedBlock{}, &CodecDao{}, &HookedDao{}, &IndexedBlock{},
+		&DailyValue{}, &OptionalDao{}, &MappedDao{}, &HeightDao{}, &AddrOutput{}, &DenormalizedTx{}, &TxByBlock{}}
+	registry := NewRegistry()
+	registry.RegisterCodec(hashCodec)
+	for _, dao := range daos {
+		info, err := registry.Lookup(dao)
+		if assert.NoError(t, err) {
+			assert.NoError(t, info.Check(info.Schema(dao)), "%T", dao)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package dago
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Retries failed statements on the next host after exponentially growing pauses, with
+// some jitter so that clients don't all retry in lockstep. Only errors for which
+// IsRetryable holds are retried. Set with SetRetryPolicy, it only applies to idempotent
+// statements.
+type ExponentialRetryPolicy struct {
+	NumRetries int
+	Min, Max   time.Duration
+}
+
+func NewExponentialRetryPolicy(numRetries int, min, max time.Duration) *ExponentialRetryPolicy {
+	return &ExponentialRetryPolicy{numRetries, min, max}
+}
+
+func (self *ExponentialRetryPolicy) Attempt(q gocql.RetryableQuery) bool {
+	if q.Attempts() > self.NumRetries {
+		return false
+	}
+	timer := time.NewTimer(self.backoff(q.Attempts()))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-q.Context().Done():
+		return false
+	}
+}
+
+func (self *ExponentialRetryPolicy) GetRetryType(err error) gocql.RetryType {
+	if IsRetryable(err) {
+		return gocql.RetryNextHost
+	}
+	return gocql.Rethrow
+}
+
+// Pause before the next attempt, between half and all of min doubled after each attempt,
+// capped at max.
+func (self *ExponentialRetryPolicy) backoff(attempts int) time.Duration {
+	min, max := self.Min, self.Max
+	if min <= 0 {
+		min = 100 * time.Millisecond
+	}
+	if max < min {
+		max = 10 * time.Second
+	}
+	d := min
+	for n := 1; n < attempts && d < max; n++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
@@ -0,0 +1,115 @@
+package dago
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// Outcome of a rollback for one table.
+type RollbackReport struct {
+	Table      string
+	Partitions int // partitions gone over
+	Rows       int // rows above the fork height, removed unless a dry run
+	Moved      int // rows copied to the orphan table
+	DryRun     bool
+}
+
+// Removes the rows above the fork height from the partitions of the provided DAOs, which are
+// expected to have values for their partition keys, following a chain reorganization. DAO
+// types must be registered with WithHeight. Rows are copied to the orphan table first if
+// any, then removed with a range tombstone per partition. A dry run only counts the rows.
+// Returns a report per table, in the order partitions were provided.
+// Example:
+//
+//	da.Registry().Register(&Output{}, dago.WithHeight("Height", "orphaned_outputs"))
+//	reports, err := da.Rollback(fork, []dago.DAOLite{&Output{Address: a1}, &Output{Address: a2}}, true)
+func (self *DataAccess) Rollback(height uint, partitions []DAOLite, dryRun bool) ([]*RollbackReport, error) {
+	da, span := self.startSpan("Rollback", OpDelete, first(partitions))
+	reports, err := da.rollback(height, partitions, dryRun)
+	rows := 0
+	for _, report := range reports {
+		rows += report.Rows
+	}
+	return reports, span.end(err, rows)
+}
+
+func (self *DataAccess) rollback(height uint, partitions []DAOLite, dryRun bool) ([]*RollbackReport, error) {
+	infos := make([]*DAOInfo, len(partitions))
+	reports := make([]*RollbackReport, 0)
+	byTable := make(map[string]*RollbackReport)
+	for n, dao := range partitions {
+		info, err := self.registry.Lookup(dao)
+		if err != nil {
+			return nil, err
+		}
+		if info.HeightField == "" {
+			return nil, errors.New("dago: " + info.Type.String() + " not registered with a height field")
+		}
+		infos[n] = info
+		table := self.tableOf(dao)
+		if byTable[table] == nil {
+			byTable[table] = &RollbackReport{Table: table, DryRun: dryRun}
+			reports = append(reports, byTable[table])
+		}
+	}
+
+	var mutex sync.Mutex
+	var firstErr error
+	sem := make(chan struct{}, self.concurrency)
+	var wg sync.WaitGroup
+	for n, dao := range partitions {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(info *DAOInfo, dao DAOLite) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			rows, moved, err := self.rollbackPartition(info, dao, height, dryRun)
+			mutex.Lock()
+			defer mutex.Unlock()
+			report := byTable[self.tableOf(dao)]
+			report.Partitions++
+			report.Rows += rows
+			report.Moved += moved
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}(infos[n], dao)
+	}
+	wg.Wait()
+	return reports, firstErr
+}
+
+func (self *DataAccess) rollbackPartition(info *DAOInfo, dao DAOLite, height uint, dryRun bool) (int, int, error) {
+	above := Gt(info.HeightField, height)
+	// rows are scanned into a copy, leaving the provided DAO as is
+	row := reflect.New(info.Type.Elem())
+	row.Elem().Set(reflect.ValueOf(dao).Elem())
+	rowDAO := row.Interface().(DAOLite)
+
+	rows, moved := 0, 0
+	orphans := ""
+	if info.OrphanTable != "" {
+		orphans = self.qualify(info.OrphanTable, info.Keyspace)
+	}
+	iter := self.PartitionIterRange(rowDAO, above)
+	for self.Next(iter, rowDAO) {
+		rows++
+		if !dryRun && orphans != "" {
+			if err := self.helperFor(rowDAO).Save(orphans, self.Fields(rowDAO)...); err != nil {
+				iter.Close()
+				return rows, moved, err
+			}
+			moved++
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return rows, moved, err
+	}
+	if dryRun || rows == 0 {
+		return rows, moved, nil
+	}
+	return rows, moved, self.DeleteRange(dao, above)
+}
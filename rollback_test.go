@@ -0,0 +1,68 @@
+package dago
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollbackValidation(t *testing.T) {
+	da := NewDataAccess(NewCQLHelper(nil))
+	_, err := da.Rollback(100, []DAOLite{&SimpleDao{AString: "foo"}}, true)
+	assert.EqualError(t, err, "dago: *dago.SimpleDao not registered with a height field")
+
+	_, err = da.Registry().Register(&SimpleDao{}, WithHeight("AString", ""))
+	assert.EqualError(t, err, "dago: invalid DAO *dago.SimpleDao: field AString: height field must be the first clustering key")
+	// range tombstones only apply to the first clustering column
+	_, err = da.Registry().Register(&SimpleDao{}, WithHeight("AnInt", "orphaned_simple_dao"))
+	assert.EqualError(t, err, "dago: invalid DAO *dago.SimpleDao: field AnInt: height field must be the first clustering key")
+	_, err = da.Registry().Register(&SimpleDao{}, WithHeight("ABigUInt", "orphaned_simple_dao"))
+	assert.NoError(t, err)
+}
+
+type HeightDao struct {
+	Address string `column:"address,key"`
+	Height  int64  `column:"bheight,sort"`
+	Hash    string `column:"tx_hash,sort"`
+	Value   int64  `column:"value"`
+}
+
+func (self *HeightDao) TableName() string {
+	return "addr_outputs"
+}
+
+func TestRollbackStatements(t *testing.T) {
+	answer := func(st *Statement) ([][]interface{}, error) {
+		if st.Op == OpSelect {
+			return [][]interface{}{{int64(5), int64(101), "ab"}, {int64(7), int64(102), "cd"}}, nil
+		}
+		return nil, nil
+	}
+	rec, da := newRecorder(answer)
+	_, err := da.Registry().Register(&HeightDao{}, WithHeight("Height", "orphaned_outputs"))
+	assert.NoError(t, err)
+	partitions := []DAOLite{&HeightDao{Address: "1abc"}}
+
+	// dry runs only read
+	reports, err := da.Rollback(100, partitions, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []*RollbackReport{{"addr_outputs", 1, 2, 0, true}}, reports)
+	assert.Equal(t, []string{"select value, bheight, tx_hash from addr_outputs where address = ? and bheight > ?"}, rec.CQL())
+	assert.Equal(t, []interface{}{"1abc", uint64(100)}, rec.statements[0].Values)
+
+	// rows are copied to the orphan table, then removed with a range tombstone
+	rec.statements = nil
+	reports, err = da.Rollback(100, partitions, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []*RollbackReport{{"addr_outputs", 1, 2, 2, false}}, reports)
+	assert.Equal(t, []string{
+		"select value, bheight, tx_hash from addr_outputs where address = ? and bheight > ?",
+		"insert into orphaned_outputs (address,bheight,tx_hash,value) values (?, ?, ?, ?)",
+		"insert into orphaned_outputs (address,bheight,tx_hash,value) values (?, ?, ?, ?)",
+		"delete from addr_outputs where address = ? and bheight > ?",
+	}, rec.CQL())
+	assert.Equal(t, []interface{}{"1abc", int64(102), "cd", int64(7)}, rec.statements[2].Values)
+	assert.Equal(t, []interface{}{"1abc", uint64(100)}, rec.statements[3].Values)
+	// the provided DAO is left as is
+	assert.Equal(t, &HeightDao{Address: "1abc"}, partitions[0])
+}
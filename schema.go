@@ -0,0 +1,511 @@
+package dago
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gocql/gocql"
+)
+
+// Definition of a table, either read from a cluster, parsed from CQL or derived from a DAO.
+type TableSchema struct {
+	Keyspace string
+	Name     string
+	// Partition keys first, then clustering keys, both in key order, then regular columns
+	Columns []*ColumnSchema
+	Indexes []*IndexSchema
+	// Table of which it's a materialized view, empty for tables
+	Base string
+}
+
+type ColumnSchema struct {
+	Name string
+	Type string // CQL type, like "text" or "map<text, frozen<list<int>>>"
+	Kind colKind
+}
+
+func (self *TableSchema) columnsOfKind(kind colKind) []*ColumnSchema {
+	cols := make([]*ColumnSchema, 0, len(self.Columns))
+	for _, col := range self.Columns {
+		if col.Kind == kind {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
+
+func (self *TableSchema) PartitionKeys() []*ColumnSchema {
+	return self.columnsOfKind(PARTITION_KEY)
+}
+
+func (self *TableSchema) ClusteringKeys() []*ColumnSchema {
+	return self.columnsOfKind(CLUSTERING_KEY)
+}
+
+func (self *TableSchema) Column(name string) *ColumnSchema {
+	for _, col := range self.Columns {
+		if col.Name == name {
+			return col
+		}
+	}
+	return nil
+}
+
+// Reads the definition of all tables and materialized views of a keyspace from system_schema.
+func ReadKeyspaceSchema(session *gocql.Session, keyspace string) ([]*TableSchema, error) {
+	return readKeyspaceSchema(NewCQLHelper(session), keyspace)
+}
+
+func readKeyspaceSchema(helper *CQLHelper, keyspace string) ([]*TableSchema, error) {
+	iter := helper.QueryIter("select table_name, column_name, kind, position, type from system_schema.columns "+
+		"where keyspace_name = ?", keyspace)
+
+	byTable := make(map[string][]positioned)
+	var table, name, kind, typ string
+	var pos int
+	for iter.Scan(&table, &name, &kind, &pos, &typ) {
+		col := &ColumnSchema{Name: name, Type: typ, Kind: NON_KEY}
+		switch kind {
+		case "partition_key":
+			col.Kind = PARTITION_KEY
+		case "clustering":
+			col.Kind = CLUSTERING_KEY
+		}
+		byTable[table] = append(byTable[table], positioned{col, pos})
+	}
+	if err := iter.Close(); err != nil {
+		return nil, classify(err)
+	}
+
+	tables := make([]*TableSchema, 0, len(byTable))
+	for table, cols := range byTable {
+		sortColumns(cols)
+		ts := &TableSchema{Keyspace: keyspace, Name: table}
+		for _, col := range cols {
+			ts.Columns = append(ts.Columns, col.col)
+		}
+		tables = append(tables, ts)
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+
+	iter = helper.QueryIter("select table_name, index_name, kind, options from system_schema.indexes "+
+		"where keyspace_name = ?", keyspace)
+	var options map[string]string
+	for iter.Scan(&table, &name, &kind, &options) {
+		idx := &IndexSchema{name, indexTarget(options["target"]), IndexNative}
+		if kind == "CUSTOM" {
+			idx.Class = options["class_name"]
+		}
+		for _, ts := range tables {
+			if ts.Name == table {
+				ts.Indexes = append(ts.Indexes, idx)
+			}
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, classify(err)
+	}
+
+	iter = helper.QueryIter("select view_name, base_table_name from system_schema.views where keyspace_name = ?",
+		keyspace)
+	var base string
+	for iter.Scan(&name, &base) {
+		for _, ts := range tables {
+			if ts.Name == name {
+				ts.Base = base
+			}
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, classify(err)
+	}
+	return tables, nil
+}
+
+// Column read from system_schema.columns with its position among the keys of its kind.
+type positioned struct {
+	col *ColumnSchema
+	pos int
+}
+
+// Sorts columns as declared: partition keys, clustering keys and then regular columns, keys by
+// position and regular columns, which have none, by name.
+func sortColumns(cols []positioned) {
+	rank := map[colKind]int{PARTITION_KEY: 0, CLUSTERING_KEY: 1, NON_KEY: 2}
+	sort.SliceStable(cols, func(i, j int) bool {
+		ki, kj := cols[i].col.Kind, cols[j].col.Kind
+		if ki != kj {
+			return rank[ki] < rank[kj]
+		}
+		if ki != NON_KEY {
+			return cols[i].pos < cols[j].pos
+		}
+		return cols[i].col.Name < cols[j].col.Name
+	})
+}
+
+// Checks all DAO types registered, or used, against the definition of their tables read from
+// the keyspace. When empty, tables are looked up in the keyspace of the DataAccess, the one
+// registered for the DAO type or the one of the session, in that order. See DAOInfo.Check.
+// Example:
+//
+//	if err := da.CheckSchema("bitcoin"); err != nil {
+//		log.Fatal(err)
+//	}
+func (self *DataAccess) CheckSchema(keyspace string) error {
+	da := self
+	if keyspace != "" {
+		da = self.In(keyspace)
+	}
+	// tables of the keyspaces read so far, by qualified name
+	byName := make(map[string]*TableSchema)
+	read := make(map[string]bool)
+	errs := make([]error, 0)
+	for _, info := range self.registry.List() {
+		dao := reflect.New(info.Type.Elem()).Interface().(DAOLite)
+		name := da.tableOf(dao)
+		if !strings.Contains(name, ".") {
+			if self.helper.keyspace == "" {
+				errs = append(errs, &DefinitionError{info.Type, "", "no keyspace to look table " + name + " up in"})
+				continue
+			}
+			name = self.helper.keyspace + "." + name
+		}
+		if ks := name[:strings.Index(name, ".")]; !read[ks] {
+			tables, err := readKeyspaceSchema(self.helper, ks)
+			if err != nil {
+				return err
+			}
+			for _, table := range tables {
+				byName[ks+"."+table.Name] = table
+			}
+			read[ks] = true
+		}
+		table := byName[name]
+		if table == nil {
+			errs = append(errs, &DefinitionError{info.Type, "", "no table " + name})
+			continue
+		}
+		errs = append(errs, info.Check(table))
+	}
+	return errors.Join(errs...)
+}
+
+// Parses the CREATE TABLE, CREATE MATERIALIZED VIEW and CREATE INDEX statements found in CQL
+// source, like the output of DESCRIBE KEYSPACE, ignoring all other statements.
+func ParseCQLSchema(src string) ([]*TableSchema, error) {
+	tables := make([]*TableSchema, 0)
+	for _, stmt := range splitStatements(stripComments(src)) {
+		words := strings.Fields(strings.ToLower(stmt))
+		if len(words) >= 3 && words[0] == "create" && (words[1] == "index" || words[1] == "custom") {
+			if err := parseCreateIndex(stmt, tables); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if len(words) >= 4 && words[0] == "create" && words[1] == "materialized" && words[2] == "view" {
+			view, err := parseCreateView(stmt, tables)
+			if err != nil {
+				return nil, err
+			}
+			tables = append(tables, view)
+			continue
+		}
+		if len(words) < 3 || words[0] != "create" || words[1] != "table" && words[1] != "columnfamily" {
+			continue
+		}
+		table, err := parseCreateTable(stmt)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+func parseCreateTable(stmt string) (*TableSchema, error) {
+	open := strings.Index(stmt, "(")
+	if open < 0 {
+		return nil, errors.New("dago: missing column definitions in " + stmt)
+	}
+	close := matchingParen(stmt, open)
+	if close < 0 {
+		return nil, errors.New("dago: unbalanced parentheses in " + stmt)
+	}
+
+	header := strings.Fields(stmt[:open])
+	table := &TableSchema{}
+	table.Keyspace, table.Name = splitTableName(header[len(header)-1])
+
+	var partition, clustering []string
+	for _, def := range splitTopLevel(stmt[open+1:close], ',') {
+		def = strings.TrimSpace(def)
+		words := strings.Fields(def)
+		if len(words) == 0 {
+			continue
+		}
+		lower := strings.ToLower(def)
+		if strings.HasPrefix(lower, "primary key") {
+			partition, clustering = parsePrimaryKey(def[strings.Index(def, "("):])
+			continue
+		}
+		col := &ColumnSchema{Name: unquoteIdent(words[0]), Kind: NON_KEY}
+		typ := strings.TrimSpace(def[len(words[0]):])
+		if idx := strings.Index(strings.ToLower(typ), " primary key"); idx >= 0 {
+			typ = typ[:idx]
+			partition = []string{col.Name}
+		}
+		if strings.HasSuffix(strings.ToLower(typ), " static") {
+			typ = typ[:len(typ)-len(" static")]
+		}
+		col.Type = normalizeType(typ)
+		table.Columns = append(table.Columns, col)
+	}
+	if err := table.setKeys(partition, clustering); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// Sets the kind of the key columns, reordering columns accordingly.
+func (self *TableSchema) setKeys(partition, clustering []string) error {
+	if len(partition) == 0 {
+		return errors.New("dago: no primary key for table " + self.Name)
+	}
+	cols := make([]*ColumnSchema, 0, len(self.Columns))
+	for kind, names := range map[colKind][]string{PARTITION_KEY: partition, CLUSTERING_KEY: clustering} {
+		for _, name := range names {
+			col := self.Column(name)
+			if col == nil {
+				return errors.New("dago: unknown key column " + name + " in table " + self.Name)
+			}
+			col.Kind = kind
+		}
+	}
+	for _, names := range [][]string{partition, clustering} {
+		for _, name := range names {
+			cols = append(cols, self.Column(name))
+		}
+	}
+	for _, col := range self.Columns {
+		if col.Kind == NON_KEY {
+			cols = append(cols, col)
+		}
+	}
+	self.Columns = cols
+	return nil
+}
+
+// Parses a CREATE [CUSTOM] INDEX [IF NOT EXISTS] [name] ON table (target) [USING 'class']
+// statement, adding the index to its table which must have been parsed before.
+func parseCreateIndex(stmt string, tables []*TableSchema) error {
+	lower := blankLower(stmt)
+	on := strings.Index(lower, " on ")
+	open := strings.Index(lower, "(")
+	if on < 0 || open < on {
+		return errors.New("dago: bad index definition " + stmt)
+	}
+	close := matchingParen(stmt, open)
+	if close < 0 {
+		return errors.New("dago: unbalanced parentheses in " + stmt)
+	}
+	keyspace, name := splitTableName(strings.TrimSpace(stmt[on+4 : open]))
+
+	idx := &IndexSchema{Class: IndexNative}
+	header := strings.Fields(stmt[:on])
+	if last := header[len(header)-1]; !strings.EqualFold(last, "index") && !strings.EqualFold(last, "exists") {
+		idx.Name = unquoteIdent(last)
+	}
+	target := strings.TrimSpace(stmt[open+1 : close])
+	if p := strings.Index(target, "("); p >= 0 && strings.HasSuffix(target, ")") {
+		target = strings.TrimSpace(target[p+1 : len(target)-1])
+	}
+	idx.Column = unquoteIdent(target)
+	if idx.Name == "" {
+		idx.Name = indexName(name, idx.Column)
+	}
+	if strings.HasPrefix(lower, "create custom") {
+		if using := strings.Index(lower[close:], "using"); using >= 0 {
+			class := strings.TrimSpace(stmt[close+using+len("using"):])
+			if end := strings.Index(class[1:], "'"); strings.HasPrefix(class, "'") && end >= 0 {
+				idx.Class = class[1 : end+1]
+			}
+		}
+	}
+	for _, table := range tables {
+		if table.Name == name && (keyspace == "" || table.Keyspace == keyspace) {
+			table.Indexes = append(table.Indexes, idx)
+			return nil
+		}
+	}
+	return errors.New("dago: index on unknown table " + name)
+}
+
+// Parses "((a, b), c, d)" or "(a, c, d)" into partition and clustering keys.
+func parsePrimaryKey(spec string) ([]string, []string) {
+	spec = strings.TrimSpace(spec)
+	spec = spec[1:matchingParen(spec, 0)]
+	parts := splitTopLevel(spec, ',')
+	var partition []string
+	first := strings.TrimSpace(parts[0])
+	if strings.HasPrefix(first, "(") {
+		for _, name := range splitTopLevel(first[1:len(first)-1], ',') {
+			partition = append(partition, unquoteIdent(strings.TrimSpace(name)))
+		}
+	} else {
+		partition = []string{unquoteIdent(first)}
+	}
+	clustering := make([]string, 0, len(parts)-1)
+	for _, name := range parts[1:] {
+		clustering = append(clustering, unquoteIdent(strings.TrimSpace(name)))
+	}
+	return partition, clustering
+}
+
+// Lower cases a type and removes white spaces, except in quoted names.
+func normalizeType(typ string) string {
+	var sb strings.Builder
+	quoted := false
+	for _, r := range typ {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			sb.WriteRune(r)
+		case quoted:
+			sb.WriteRune(r)
+		case unicode.IsSpace(r):
+		case r == ',':
+			sb.WriteString(", ")
+		default:
+			sb.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return sb.String()
+}
+
+func unquoteIdent(name string) string {
+	if len(name) > 1 && name[0] == '"' && name[len(name)-1] == '"' {
+		return strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
+	}
+	return strings.ToLower(name)
+}
+
+func matchingParen(s string, open int) int {
+	depth := 0
+	for n := open; n < len(s); n++ {
+		switch s[n] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return n
+			}
+		}
+	}
+	return -1
+}
+
+// Splits on sep when outside of parentheses, angle brackets and quotes.
+func splitTopLevel(s string, sep byte) []string {
+	parts := make([]string, 0)
+	// angle brackets only count as parameters of types, not comparisons
+	depth, angles, start := 0, 0, 0
+	for n := 0; n < len(s); n++ {
+		if q := quotedLen(s[n:]); q > 0 {
+			n += q - 1
+			continue
+		}
+		c := s[n]
+		switch {
+		case c == '<' && parameterized(s[:n]):
+			depth++
+			angles++
+		case c == '>' && angles > 0:
+			depth--
+			angles--
+		case strings.IndexByte("({[", c) >= 0:
+			depth++
+		case strings.IndexByte(")}]", c) >= 0:
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:n])
+			start = n + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func splitStatements(src string) []string {
+	stmts := make([]string, 0)
+	for _, stmt := range splitTopLevel(src, ';') {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
+
+// Tells whether the CQL text ends with the name of a type taking parameters, like frozen.
+func parameterized(s string) bool {
+	s = strings.TrimRight(s, " \t\n")
+	start := strings.LastIndexFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	switch strings.ToLower(s[start+1:]) {
+	case "frozen", "list", "set", "map", "tuple", "vector":
+		return true
+	}
+	return false
+}
+
+// Length of the string literal, quoted identifier or $$ string the CQL text starts with, all
+// of it when not terminated, or 0 when it starts with none.
+func quotedLen(s string) int {
+	delim := ""
+	switch {
+	case strings.HasPrefix(s, "$$"):
+		delim = "$$"
+	case s != "" && (s[0] == '\'' || s[0] == '"'):
+		delim = s[:1]
+	default:
+		return 0
+	}
+	end := strings.Index(s[len(delim):], delim)
+	if end < 0 {
+		return len(s)
+	}
+	return end + 2*len(delim)
+}
+
+// Removes --, // and /* */ comments, outside of quotes.
+func stripComments(src string) string {
+	var sb strings.Builder
+	for n := 0; n < len(src); n++ {
+		if q := quotedLen(src[n:]); q > 0 {
+			sb.WriteString(src[n : n+q])
+			n += q - 1
+			continue
+		}
+		switch {
+		case strings.HasPrefix(src[n:], "--") || strings.HasPrefix(src[n:], "//"):
+			for n < len(src) && src[n] != '\n' {
+				n++
+			}
+		case strings.HasPrefix(src[n:], "/*"):
+			end := strings.Index(src[n+2:], "*/")
+			if end < 0 {
+				return sb.String()
+			}
+			n += end + 3
+			continue
+		}
+		if n < len(src) {
+			sb.WriteByte(src[n])
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,191 @@
+package dago
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSchema = `
+CREATE KEYSPACE bitcoin WITH replication = {'class': 'SimpleStrategy', 'replication_factor': '1'};
+
+-- outputs by address
+CREATE TABLE bitcoin.addr_outputs (
+    address text,
+    bheight bigint,
+    tx_hash blob, // comment
+    "Value" varint,
+    spent_by map<text, frozen<list<int>>>,
+    memo text static,
+    PRIMARY KEY ((address), bheight, tx_hash)
+) WITH CLUSTERING ORDER BY (bheight DESC, tx_hash ASC)
+    AND comment = 'a; b';
+
+CREATE TABLE blocks (hash blob PRIMARY KEY, height bigint);
+CREATE INDEX ON blocks (height);
+`
+
+func TestParseCQLSchema(t *testing.T) {
+	tables, err := ParseCQLSchema(testSchema)
+	assert.NoError(t, err)
+	assert.Len(t, tables, 2)
+
+	outs := tables[0]
+	assert.Equal(t, "bitcoin", outs.Keyspace)
+	assert.Equal(t, "addr_outputs", outs.Name)
+	assert.Equal(t, []*ColumnSchema{
+		{"address", "text", PARTITION_KEY},
+		{"bheight", "bigint", CLUSTERING_KEY},
+		{"tx_hash", "blob", CLUSTERING_KEY},
+		{"Value", "varint", NON_KEY},
+		{"spent_by", "map<text, frozen<list<int>>>", NON_KEY},
+		{"memo", "text", NON_KEY},
+	}, outs.Columns)
+
+	blocks := tables[1]
+	assert.Equal(t, "", blocks.Keyspace)
+	assert.Equal(t, []*ColumnSchema{{"hash", "blob", PARTITION_KEY}, {"height", "bigint", NON_KEY}}, blocks.Columns)
+}
+
+func TestSortColumns(t *testing.T) {
+	// as read from system_schema.columns, in clustering order
+	cols := []positioned{
+		{&ColumnSchema{"value", "varint", NON_KEY}, -1},
+		{&ColumnSchema{"tx_hash", "blob", CLUSTERING_KEY}, 1},
+		{&ColumnSchema{"network", "text", PARTITION_KEY}, 1},
+		{&ColumnSchema{"memo", "text", NON_KEY}, -1},
+		{&ColumnSchema{"bheight", "bigint", CLUSTERING_KEY}, 0},
+		{&ColumnSchema{"address", "text", PARTITION_KEY}, 0},
+	}
+	sortColumns(cols)
+	names := make([]string, len(cols))
+	for n, col := range cols {
+		names[n] = col.col.Name
+	}
+	assert.Equal(t, []string{"address", "network", "bheight", "tx_hash", "memo", "value"}, names)
+}
+
+func TestGoTypeOf(t *testing.T) {
+	typ, imports := GoTypeOf("map<text, frozen<list<int>>>")
+	assert.Equal(t, "map[string][]int32", typ)
+	assert.Empty(t, imports)
+	typ, imports = GoTypeOf("set<timeuuid>")
+	assert.Equal(t, "[]gocql.UUID", typ)
+	assert.Equal(t, []string{"github.com/gocql/gocql"}, imports)
+	typ, _ = GoTypeOf("frozen<address>")
+	assert.Equal(t, "map[string]interface{}", typ)
+}
+
+func TestCheckCQLType(t *testing.T) {
+	tests := []struct {
+		value   interface{}
+		cqlType string
+		ok      bool
+	}{
+		{int8(0), "tinyint", true},
+		{int16(0), "tinyint", false},
+		{int32(0), "int", true},
+		{int64(0), "int", false},
+		{uint32(0), "int", false},
+		{uint32(0), "bigint", true},
+		{uint64(0), "bigint", false},
+		{uint64(0), "varint", true},
+		{Height(0), "int", true},
+		{float32(0), "float", true},
+		{float64(0), "float", false},
+		{float32(0), "double", true},
+		{"", "text", true},
+		{"", "int", false},
+		{[]byte{}, "blob", true},
+		{[4]byte{}, "blob", false},
+		{time.Time{}, "timestamp", true},
+		{time.Second, "timestamp", false},
+		{time.Second, "duration", true},
+		{gocql.UUID{}, "timeuuid", true},
+		{big.NewInt(0), "varint", true},
+		{NullOf(int64(0)), "bigint", true},
+		{NullOf(int64(0)), "int", false},
+		{new(int32), "int", true},
+		{map[string][]int32{}, "map<text, frozen<list<int>>>", true},
+		{map[string][]int64{}, "map<text, frozen<list<int>>>", false},
+		{[]string{}, "set<text>", true},
+		{"", "list<text>", false},
+		{map[string]interface{}{}, "frozen<address>", true},
+	}
+	for _, test := range tests {
+		err := checkCQLType(reflect.TypeOf(test.value), test.cqlType)
+		assert.Equal(t, test.ok, err == nil, "%T in %s: %v", test.value, test.cqlType, err)
+	}
+	assert.EqualError(t, checkCQLType(reflect.TypeOf(uint64(0)), "bigint"), "uint64 values can't be stored in bigint columns")
+}
+
+type AddrOutput struct {
+	Address string `column:"address,key"`
+	Height  uint64 `column:"bheight,sort"`
+	TxHash  []byte `column:"tx_hash"`
+	Memo    string `column:"memo"`
+}
+
+func (self *AddrOutput) TableName() string {
+	return "addr_outputs"
+}
+
+func TestDAOCheck(t *testing.T) {
+	tables, _ := ParseCQLSchema(testSchema)
+	info, err := NewRegistry().Register(&AddrOutput{})
+	assert.NoError(t, err)
+	assert.EqualError(t, info.Check(tables[0]), "dago: invalid DAO *dago.AddrOutput: field Height: column bheight: uint64 values can't be stored in bigint columns\n"+
+		"dago: invalid DAO *dago.AddrOutput: field TxHash: key qualifier doesn't match column tx_hash\n"+
+		"dago: invalid DAO *dago.AddrOutput: table addr_outputs has 3 key columns, not 2")
+}
+
+type CheckedBlock struct {
+	Hash   []byte `column:"hash,key"`
+	Height int64  `column:"height"`
+}
+
+func (self *CheckedBlock) TableName() string {
+	return "blocks"
+}
+
+func TestCheckSchema(t *testing.T) {
+	rec, da := newRecorder(func(st *Statement) ([][]interface{}, error) {
+		if strings.Contains(st.CQL, "system_schema.columns") && st.Values[0] == "bitcoin" {
+			return [][]interface{}{{"blocks", "hash", "partition_key", 0, "blob"}, {"blocks", "height", "regular", -1, "bigint"}}, nil
+		}
+		return nil, nil
+	})
+	assert.NoError(t, da.Register(&CheckedBlock{}))
+	assert.EqualError(t, da.CheckSchema(""), "dago: invalid DAO *dago.CheckedBlock: no keyspace to look table blocks up in")
+	assert.Empty(t, rec.statements)
+
+	// the keyspace of the session is used when neither the DataAccess nor the DAO has one
+	da.helper.keyspace = "bitcoin"
+	assert.NoError(t, da.CheckSchema(""))
+	assert.EqualError(t, da.In("testnet3").CheckSchema(""), "dago: invalid DAO *dago.CheckedBlock: no table testnet3.blocks")
+	assert.EqualError(t, da.CheckSchema("testnet3"), "dago: invalid DAO *dago.CheckedBlock: no table testnet3.blocks")
+}
+
+func TestSplitTopLevel(t *testing.T) {
+	tests := []struct {
+		src   string
+		sep   byte
+		parts []string
+	}{
+		{`a text, m map<text, frozen<list<int>>>, "x<y" int`, ',', []string{"a text", " m map<text, frozen<list<int>>>", ` "x<y" int`}},
+		{`comment = 'a>b;c'; x`, ';', []string{`comment = 'a>b;c'`, " x"}},
+		{`select * from t where h >= 0 and a < 5 primary key (a, h); create table u (a int primary key)`, ';',
+			[]string{"select * from t where h >= 0 and a < 5 primary key (a, h)", " create table u (a int primary key)"}},
+		{`$$ ; $$; x`, ';', []string{"$$ ; $$", " x"}},
+		{`f FROZEN <address>, 'it''s, quoted'`, ',', []string{"f FROZEN <address>", " 'it''s, quoted'"}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.parts, splitTopLevel(test.src, test.sep), test.src)
+	}
+	assert.Equal(t, "a '-- kept' $$ // kept $$ b \n", stripComments("a '-- kept' $$ // kept $$ b -- dropped\n"))
+}
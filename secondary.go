@@ -0,0 +1,138 @@
+package dago
+
+import (
+	"errors"
+)
+
+// Copy of a DAO in another table with its own primary key, like a query table, all DAO
+// columns being stored there too.
+type TableMapping struct {
+	Table string
+	// Key fields of the DAO, in key order, which can't be omitempty
+	PartitionKeys  []string
+	ClusteringKeys []string
+}
+
+// DAOs denormalized into several tables implement this interface. Save, SavePartial, SaveJSON,
+// Delete and DeleteFields then write to or remove from the table of the DAO and all secondary
+// tables in a single logged batch, secondary keys being read from the DAO fields, or JSON
+// object, so deletes need them set. SaveIfNotExists, DeletePartition and DeleteRange are
+// refused, as are height fields for rollbacks. Reads and copies only go to the DAO table.
+// Example:
+//
+//	func (self *Tx) SecondaryTables() []*dago.TableMapping {
+//		return []*dago.TableMapping{
+//			{Table: "txs_by_block", PartitionKeys: []string{"BlockHash"}, ClusteringKeys: []string{"Index"}},
+//			{Table: "txs_by_addr", PartitionKeys: []string{"Address"}, ClusteringKeys: []string{"Height", "Hash"}},
+//		}
+//	}
+type DAOSecondaryTables interface {
+	SecondaryTables() []*TableMapping
+}
+
+var (
+	errSecondaryLWT   = errors.New("dago: lightweight transactions aren't supported for DAOs with secondary tables")
+	errSecondaryRange = errors.New("dago: partition and range deletes aren't supported for DAOs with secondary tables")
+)
+
+// Checks the secondary tables of the DAO against its fields.
+func secondaryTables(info *DAOInfo, dao interface{}) error {
+	st, ok := dao.(DAOSecondaryTables)
+	if !ok {
+		return nil
+	}
+	info.Secondary = st.SecondaryTables()
+	for _, m := range info.Secondary {
+		if m.Table == "" || len(m.PartitionKeys) == 0 {
+			return &DefinitionError{info.Type, "", "secondary tables need a name and a partition key"}
+		}
+		for _, field := range append(m.PartitionKeys[:len(m.PartitionKeys):len(m.PartitionKeys)], m.ClusteringKeys...) {
+			col := info.column(field)
+			if col == nil {
+				return &DefinitionError{info.Type, field, "unknown key field of secondary table " + m.Table}
+			}
+			// empty values would be left out of, or unset in, the rows of the secondary table
+			if col.OmitEmpty {
+				return &DefinitionError{info.Type, field, "key fields of secondary table " + m.Table + " can't be omitempty"}
+			}
+		}
+	}
+	return nil
+}
+
+// Registered info of the DAO when it has secondary tables, nil otherwise.
+func (self *DataAccess) denormalized(dao DAOLite) *DAOInfo {
+	info, err := self.registry.Lookup(dao)
+	if err != nil || len(info.Secondary) == 0 {
+		return nil
+	}
+	return info
+}
+
+// Key values of the DAO in the secondary table.
+func (self *DataAccess) secondaryKeys(dao DAOLite, m *TableMapping) []*F {
+	names := append(m.PartitionKeys[:len(m.PartitionKeys):len(m.PartitionKeys)], m.ClusteringKeys...)
+	keys := make([]*F, 0, len(names))
+	for _, name := range names {
+		// the DAO is checked by the operation
+		fields, _ := self.fieldsOfKind(dao, ANY, []string{name})
+		keys = append(keys, fields...)
+	}
+	return keys
+}
+
+// Saves the named fields, all of them when none, to all tables of the DAO in a batch.
+func (self *DataAccess) saveDenormalized(dao DAOLite, info *DAOInfo, fields []string) error {
+	if err := self.beforeSave(dao); err != nil {
+		return err
+	}
+	helper := self.helperFor(dao)
+	table := self.tableOf(dao)
+	params, err := self.saveFields(dao, fields)
+	if err != nil {
+		return err
+	}
+	stmts := []*Statement{helper.save(table, false, params...)}
+	for _, m := range info.Secondary {
+		secParams := params
+		if len(fields) > 0 {
+			secParams = append(params[:len(params):len(params)], self.missingFields(params, self.secondaryKeys(dao, m))...)
+		}
+		stmts = append(stmts, helper.save(self.qualify(m.Table, info.Keyspace), false, secParams...))
+	}
+	res := helper.exec(helper.batch(table, stmts...))
+	self.afterSave(dao, res)
+	return res
+}
+
+// Fields of more not already in fields.
+func (self *DataAccess) missingFields(fields, more []*F) []*F {
+	missing := make([]*F, 0, len(more))
+	for _, m := range more {
+		found := false
+		for _, f := range fields {
+			found = found || f.Name == m.Name
+		}
+		if !found {
+			missing = append(missing, m)
+		}
+	}
+	return missing
+}
+
+// Deletes the row of the DAO from all its tables in a batch, or only the values of the
+// columns when provided.
+func (self *DataAccess) deleteDenormalized(dao DAOLite, info *DAOInfo, cols []string) error {
+	if err := self.beforeDelete(dao); err != nil {
+		return err
+	}
+	helper := self.helperFor(dao)
+	table := self.tableOf(dao)
+	stmts := []*Statement{helper.deleteWhere(table, cols, self.Keys(dao), nil)}
+	for _, m := range info.Secondary {
+		stmts = append(stmts, helper.deleteWhere(self.qualify(m.Table, info.Keyspace), cols, self.secondaryKeys(dao, m), nil))
+	}
+	res := helper.exec(helper.batch(table, stmts...))
+	self.afterDelete(dao, res)
+	return res
+}
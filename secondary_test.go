@@ -0,0 +1,107 @@
+package dago
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type DenormalizedTx struct {
+	Hash      string `column:"hash,key"`
+	BlockHash string `column:"block_hash"`
+	Index     int    `column:"idx"`
+	Fees      int64  `column:"fees"`
+}
+
+func (self *DenormalizedTx) TableName() string {
+	return "txs"
+}
+
+func (self *DenormalizedTx) SecondaryTables() []*TableMapping {
+	return []*TableMapping{{Table: "txs_by_block", PartitionKeys: []string{"BlockHash"}, ClusteringKeys: []string{"Index"}}}
+}
+
+type BadMappingTx struct {
+	Hash string `column:"hash,key"`
+}
+
+func (self *BadMappingTx) TableName() string {
+	return "txs"
+}
+
+func (self *BadMappingTx) SecondaryTables() []*TableMapping {
+	return []*TableMapping{{Table: "txs_by_block", PartitionKeys: []string{"Block"}}}
+}
+
+type OmitKeyTx struct {
+	Hash      string `column:"hash,key"`
+	BlockHash string `column:"block_hash,omitempty"`
+}
+
+func (self *OmitKeyTx) TableName() string {
+	return "txs"
+}
+
+func (self *OmitKeyTx) SecondaryTables() []*TableMapping {
+	return []*TableMapping{{Table: "txs_by_block", PartitionKeys: []string{"BlockHash"}}}
+}
+
+func TestSecondaryTables(t *testing.T) {
+	da := NewDataAccess(NewCQLHelper(nil))
+	tx := &DenormalizedTx{"ab", "cd", 3, 10}
+	info := da.denormalized(tx)
+	if assert.NotNil(t, info) {
+		assert.Equal(t, []*F{{"block_hash", "cd"}, {"idx", int64(3)}}, da.secondaryKeys(tx, info.Secondary[0]))
+	}
+	assert.Nil(t, da.denormalized(&SimpleDao{}))
+	assert.Equal(t, errSecondaryLWT, da.SaveIfNotExists(tx))
+
+	params := []*F{{"hash", "ab"}, {"fees", int64(10)}}
+	assert.Equal(t, []*F{{"block_hash", "cd"}}, da.missingFields(params, []*F{{"block_hash", "cd"}, {"hash", "ab"}}))
+
+	assert.EqualError(t, da.Register(&BadMappingTx{}),
+		"dago: invalid DAO *dago.BadMappingTx: field Block: unknown key field of secondary table txs_by_block")
+
+	// empty keys would be left out of secondary rows, or bound as unset
+	rec, da := newRecorder(nil)
+	msg := "dago: invalid DAO *dago.OmitKeyTx: field BlockHash: key fields of secondary table txs_by_block can't be omitempty"
+	assert.EqualError(t, da.Save(&OmitKeyTx{Hash: "ab"}), msg)
+	da.SetUnsetEmpty(true)
+	assert.EqualError(t, da.Save(&OmitKeyTx{Hash: "ab"}), msg)
+	assert.Empty(t, rec.statements)
+}
+
+func TestSecondaryWrites(t *testing.T) {
+	rec, da := newRecorder(nil)
+	tx := &DenormalizedTx{"ab", "cd", 3, 10}
+	assert.NoError(t, da.DeleteFields(tx, "Fees"))
+	assert.Equal(t, []string{"begin batch delete fees from txs where hash = ?; " +
+		"delete fees from txs_by_block where block_hash = ? and idx = ?; apply batch"}, rec.CQL())
+	assert.EqualError(t, da.DeleteFields(tx, "BlockHash"), "dago: cannot delete BlockHash, key of secondary table txs_by_block")
+
+	rec.statements = nil
+	assert.NoError(t, da.SaveJSON(tx, json.RawMessage(`{"hash": "ab", "block_hash": "cd", "idx": 3}`)))
+	if assert.Len(t, rec.statements, 1) {
+		assert.Equal(t, OpBatch, rec.statements[0].Op)
+		assert.Equal(t, []string{"insert into txs json ? default unset", "insert into txs_by_block json ? default unset"}, statementsCQL(rec.statements[0].Statements))
+	}
+	assert.EqualError(t, da.SaveJSON(tx, json.RawMessage(`{"hash": "ab", "block_hash": "cd"}`)),
+		"dago: missing key column idx of secondary table txs_by_block in JSON object")
+
+	// rows of secondary tables can't be found from the partition of the DAO table
+	rec.statements = nil
+	assert.Equal(t, errSecondaryRange, da.DeletePartition(tx))
+	assert.Equal(t, errSecondaryRange, da.DeleteRange(tx, Gt("Index", 1)))
+	_, err := da.Registry().Register(tx, WithHeight("Index", ""))
+	assert.EqualError(t, err, "dago: invalid DAO *dago.DenormalizedTx: field Index: height field not supported with secondary tables")
+	assert.Empty(t, rec.statements)
+}
+
+func statementsCQL(stmts []*Statement) []string {
+	cql := make([]string, len(stmts))
+	for n, st := range stmts {
+		cql[n] = st.CQL
+	}
+	return cql
+}
@@ -0,0 +1,197 @@
+// Package tagcheck defines an analyzer reporting invalid DAO definitions at compile time,
+// rather than at runtime when DataAccess first uses them. It checks all types implementing
+// dago.DAOLite for:
+//
+//   - unknown column tag qualifiers and exported fields without a column tag, embedded ones
+//     being ignored
+//   - duplicate column names
+//   - missing partition key
+//   - TableName methods without a pointer receiver, DAOs always being passed as pointers
+//   - field types that can't be stored, like channels and functions
+//   - qualifiers that can't be used together, like omitempty on key fields
+//
+// Run it with go vet -vettool=$(which dagovet).
+package tagcheck
+
+import (
+	"go/ast"
+	"go/types"
+	"reflect"
+	"strings"
+
+	"github.com/blockcypher/dago"
+	"golang.org/x/tools/go/analysis"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name: "dagotags",
+	Doc:  "check column tags and definition of dago DAO structs",
+	Run:  run,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	for _, file := range pass.Files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			ts, ok := node.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok {
+				return true
+			}
+			obj, ok := pass.TypesInfo.Defs[ts.Name].(*types.TypeName)
+			if !ok {
+				return true
+			}
+			if method := tableName(obj.Type()); method != nil {
+				checkDAO(pass, ts, st, method)
+			}
+			return true
+		})
+	}
+	return nil, nil
+}
+
+// TableName method of the type when it implements DAOLite, through a pointer or not.
+func tableName(t types.Type) *types.Func {
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(t), false, nil, "TableName")
+	method, ok := obj.(*types.Func)
+	if !ok {
+		return nil
+	}
+	sig := method.Type().(*types.Signature)
+	if sig.Params().Len() != 0 || sig.Results().Len() != 1 ||
+		!types.Identical(sig.Results().At(0).Type(), types.Typ[types.String]) {
+		return nil
+	}
+	return method
+}
+
+func checkDAO(pass *analysis.Pass, ts *ast.TypeSpec, st *ast.StructType, method *types.Func) {
+	recv := method.Type().(*types.Signature).Recv()
+	if _, ptr := recv.Type().(*types.Pointer); !ptr && method.Pkg() == pass.Pkg {
+		pass.Reportf(method.Pos(), "TableName of DAO %s should have a pointer receiver", ts.Name.Name)
+	}
+
+	cols := make(map[string]bool)
+	hasPartitionKey := false
+	var checkFields func(st *ast.StructType)
+	checkFields = func(st *ast.StructType) {
+		for _, f := range st.Fields.List {
+			col, quals, ok := parseTag(f)
+			anonymous := len(f.Names) == 0
+			if !anonymous && !f.Names[0].IsExported() {
+				// ignored by DataAccess
+				continue
+			}
+			if !ok {
+				if !anonymous {
+					pass.Reportf(f.Pos(), "field %s of DAO %s has no column tag", f.Names[0].Name, ts.Name.Name)
+				}
+				continue
+			}
+			traverse, skip := false, false
+			for _, qual := range quals {
+				switch {
+				case qual == "traverse":
+					traverse = true
+				case qual == "key":
+					hasPartitionKey = true
+				case !dago.StringInList(qual, dago.TagQualifiers()):
+					if anonymous {
+						skip = true
+					} else {
+						pass.Reportf(f.Tag.Pos(), "bad column tag qualifier %q", qual)
+					}
+				}
+			}
+			if skip {
+				continue
+			}
+			if conflict := dago.QualifierConflict(quals); conflict != "" {
+				pass.Reportf(f.Tag.Pos(), "%s", conflict)
+			}
+			if traverse {
+				if inner := traversedStruct(pass, f.Type); inner != nil && anonymous {
+					checkFields(inner)
+				} else {
+					pass.Reportf(f.Pos(), "traversed field must be an embedded pointer to a struct declared in the package")
+				}
+				continue
+			}
+			if cols[col] {
+				pass.Reportf(f.Tag.Pos(), "duplicate column %q", col)
+			}
+			cols[col] = true
+			if !storable(pass.TypesInfo.TypeOf(f.Type)) {
+				pass.Reportf(f.Pos(), "field type %s can't be stored", pass.TypesInfo.TypeOf(f.Type))
+			}
+		}
+	}
+	checkFields(st)
+
+	if !hasPartitionKey {
+		pass.Reportf(ts.Pos(), "DAO %s has no partition key, tag at least one field with the key qualifier", ts.Name.Name)
+	}
+}
+
+func parseTag(f *ast.Field) (string, []string, bool) {
+	if f.Tag == nil {
+		return "", nil, false
+	}
+	tag, ok := reflect.StructTag(strings.Trim(f.Tag.Value, "`")).Lookup("column")
+	if !ok {
+		return "", nil, false
+	}
+	spec := strings.Split(tag, ",")
+	return spec[0], spec[1:], true
+}
+
+func traversedStruct(pass *analysis.Pass, expr ast.Expr) *ast.StructType {
+	star, ok := expr.(*ast.StarExpr)
+	if !ok {
+		return nil
+	}
+	named, ok := pass.TypesInfo.TypeOf(star.X).(*types.Named)
+	if !ok || named.Obj().Pkg() != pass.Pkg {
+		return nil
+	}
+	for _, file := range pass.Files {
+		for _, decl := range file.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok && pass.TypesInfo.Defs[ts.Name] == named.Obj() {
+					st, _ := ts.Type.(*ast.StructType)
+					return st
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Tells whether values of the type can be marshalled by gocql.
+func storable(t types.Type) bool {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch u.Kind() {
+		case types.Complex64, types.Complex128, types.UnsafePointer, types.Uintptr:
+			return false
+		}
+	case *types.Chan, *types.Signature:
+		return false
+	case *types.Pointer:
+		return storable(u.Elem())
+	case *types.Slice:
+		return storable(u.Elem())
+	case *types.Array:
+		return storable(u.Elem())
+	case *types.Map:
+		return storable(u.Key()) && storable(u.Elem())
+	}
+	return true
+}
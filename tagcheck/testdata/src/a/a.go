@@ -0,0 +1,43 @@
+package a
+
+type Good struct {
+	Address string `column:"address,key"`
+	Height  int64  `column:"bheight,sort"`
+	SSN     string `column:"ssn,redact,index=sai"`
+	*Common `column:",traverse"`
+}
+
+func (self *Good) TableName() string { return "good" }
+
+type Common struct {
+	Created int64 `column:"created"`
+}
+
+// Embedded without a column tag, ignored like unexported fields
+type Meta struct {
+	Source string
+}
+
+type Embedding struct {
+	Address string `column:"address,key"`
+	Meta
+	internal string
+}
+
+func (self *Embedding) TableName() string { return "embedding" }
+
+type Bad struct { // want `DAO Bad has no partition key`
+	Address string    `column:"address,primary"` // want `bad column tag qualifier "primary"`
+	Other   string    `column:"address"`         // want `duplicate column "address"`
+	Notify  chan bool `column:"notify"`          // want `field type chan bool can't be stored`
+	Untaged string    // want `field Untaged of DAO Bad has no column tag`
+	ignored string
+	Amount  complex128 `column:"amount"`              // want `field type complex128 can't be stored`
+	Time    int64      `column:"time,sort,omitempty"` // want `key fields can't be omitempty`
+}
+
+func (self Bad) TableName() string { return "bad" } // want `TableName of DAO Bad should have a pointer receiver`
+
+type NotADao struct {
+	Whatever string
+}
@@ -0,0 +1,269 @@
+package transfer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/blockcypher/dago"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Writes values as their JSON text, unquoted for strings, and nulls as empty values, so
+// that empty strings can't be told apart from nulls when importing.
+type csvWriter struct {
+	w      *csv.Writer
+	cols   []string
+	header bool
+}
+
+func newCSVWriter(w io.Writer, table *dago.TableSchema) *csvWriter {
+	cols := make([]string, len(table.Columns))
+	for n, col := range table.Columns {
+		cols[n] = col.Name
+	}
+	return &csvWriter{csv.NewWriter(w), cols, false}
+}
+
+func (self *csvWriter) Write(r row) error {
+	if !self.header {
+		self.header = true
+		if err := self.w.Write(self.cols); err != nil {
+			return err
+		}
+	}
+	record := make([]string, len(self.cols))
+	for n, col := range self.cols {
+		record[n] = textOf(r[jsonKey(col)])
+	}
+	return self.w.Write(record)
+}
+
+func (self *csvWriter) Close() error {
+	self.w.Flush()
+	return self.w.Error()
+}
+
+type csvReader struct {
+	r     *csv.Reader
+	cols  []string
+	kinds []jsonKind
+}
+
+// Reads CSV with a header row naming the columns, in any order.
+func newCSVReader(r io.Reader, table *dago.TableSchema) (*csvReader, error) {
+	reader := &csvReader{r: csv.NewReader(r)}
+	header, err := reader.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range header {
+		col := table.Column(name)
+		if col == nil {
+			return nil, errors.New("transfer: unknown column " + name + " in CSV header")
+		}
+		reader.cols = append(reader.cols, name)
+		reader.kinds = append(reader.kinds, jsonKindOf(col.Type))
+	}
+	return reader, nil
+}
+
+func (self *csvReader) Read() (row, error) {
+	record, err := self.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	r := make(row, len(record))
+	for n, text := range record {
+		r[jsonKey(self.cols[n])] = valueOf(text, self.kinds[n])
+	}
+	return r, nil
+}
+
+type jsonlWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func newJSONLWriter(w io.Writer) *jsonlWriter {
+	bw := bufio.NewWriter(w)
+	return &jsonlWriter{bw, json.NewEncoder(bw)}
+}
+
+func (self *jsonlWriter) Write(r row) error {
+	return self.enc.Encode(r)
+}
+
+func (self *jsonlWriter) Close() error {
+	return self.w.Flush()
+}
+
+type jsonlReader struct {
+	dec *json.Decoder
+}
+
+func newJSONLReader(r io.Reader) *jsonlReader {
+	return &jsonlReader{json.NewDecoder(r)}
+}
+
+func (self *jsonlReader) Read() (row, error) {
+	var r row
+	if err := self.dec.Decode(&r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Parquet schema of a table, all columns optional. Integers are stored as int64, floats as
+// doubles, booleans as is and all other values as the text of their JSON encoding.
+func parquetSchema(table *dago.TableSchema) *parquet.Schema {
+	group := make(parquet.Group, len(table.Columns))
+	for _, col := range table.Columns {
+		var node parquet.Node
+		switch jsonKindOf(col.Type) {
+		case jsonInt:
+			node = parquet.Int(64)
+		case jsonFloat:
+			node = parquet.Leaf(parquet.DoubleType)
+		case jsonBool:
+			node = parquet.Leaf(parquet.BooleanType)
+		default:
+			node = parquet.String()
+		}
+		group[col.Name] = parquet.Optional(node)
+	}
+	return parquet.NewSchema(table.Name, group)
+}
+
+type parquetColumn struct {
+	name  string
+	kind  jsonKind
+	index int
+}
+
+func parquetColumns(schema *parquet.Schema, table *dago.TableSchema) []*parquetColumn {
+	cols := make([]*parquetColumn, 0, len(table.Columns))
+	for _, col := range table.Columns {
+		if leaf, ok := schema.Lookup(col.Name); ok {
+			cols = append(cols, &parquetColumn{col.Name, jsonKindOf(col.Type), leaf.ColumnIndex})
+		}
+	}
+	return cols
+}
+
+type parquetWriter struct {
+	w    *parquet.Writer
+	cols []*parquetColumn
+}
+
+func newParquetWriter(w io.Writer, table *dago.TableSchema) *parquetWriter {
+	schema := parquetSchema(table)
+	return &parquetWriter{parquet.NewWriter(w, schema), parquetColumns(schema, table)}
+}
+
+func (self *parquetWriter) Write(r row) error {
+	values := make(parquet.Row, len(self.cols))
+	for _, col := range self.cols {
+		value, err := parquetValue(r[jsonKey(col.name)], col.kind)
+		if err != nil {
+			return errors.New("transfer: column " + col.name + ": " + err.Error())
+		}
+		if value.IsNull() {
+			values[col.index] = value.Level(0, 0, col.index)
+		} else {
+			values[col.index] = value.Level(0, 1, col.index)
+		}
+	}
+	_, err := self.w.WriteRows([]parquet.Row{values})
+	return err
+}
+
+func (self *parquetWriter) Close() error {
+	return self.w.Close()
+}
+
+func parquetValue(value json.RawMessage, kind jsonKind) (parquet.Value, error) {
+	text := textOf(value)
+	if text == "" && (len(value) == 0 || string(value) == "null") {
+		return parquet.Value{}, nil
+	}
+	switch kind {
+	case jsonInt:
+		n, err := strconv.ParseInt(text, 10, 64)
+		return parquet.Int64Value(n), err
+	case jsonFloat:
+		f, err := strconv.ParseFloat(text, 64)
+		return parquet.DoubleValue(f), err
+	case jsonBool:
+		b, err := strconv.ParseBool(text)
+		return parquet.BooleanValue(b), err
+	}
+	return parquet.ByteArrayValue([]byte(text)), nil
+}
+
+type parquetReader struct {
+	r    *parquet.Reader
+	cols []*parquetColumn
+	buf  []parquet.Row
+}
+
+func newParquetReader(r io.Reader, table *dago.TableSchema) (*parquetReader, error) {
+	ra, ok := r.(io.ReaderAt)
+	seeker, ok2 := r.(io.Seeker)
+	if !ok || !ok2 {
+		return nil, errors.New("transfer: parquet input must be seekable")
+	}
+	size, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	file, err := parquet.OpenFile(ra, size)
+	if err != nil {
+		return nil, err
+	}
+	schema := file.Schema()
+	for _, col := range table.Columns {
+		if _, ok := schema.Lookup(col.Name); !ok {
+			return nil, errors.New("transfer: no column " + col.Name + " in parquet file")
+		}
+	}
+	return &parquetReader{parquet.NewReader(file), parquetColumns(schema, table), make([]parquet.Row, 1)}, nil
+}
+
+func (self *parquetReader) Read() (row, error) {
+	n, err := self.r.ReadRows(self.buf)
+	if n == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	values := self.buf[0]
+	r := make(row, len(self.cols))
+	for _, col := range self.cols {
+		value := values[col.index]
+		key := jsonKey(col.name)
+		switch {
+		case value.IsNull():
+			r[key] = jsonNull
+		case col.kind == jsonInt:
+			r[key] = json.RawMessage(strconv.FormatInt(value.Int64(), 10))
+		case col.kind == jsonFloat:
+			f := value.Double()
+			if math.IsInf(f, 0) || math.IsNaN(f) {
+				r[key] = valueOf(strconv.FormatFloat(f, 'g', -1, 64), jsonString)
+			} else {
+				r[key] = json.RawMessage(strconv.FormatFloat(f, 'g', -1, 64))
+			}
+		case col.kind == jsonBool:
+			r[key] = json.RawMessage(strconv.FormatBool(value.Boolean()))
+		default:
+			r[key] = valueOf(string(value.ByteArray()), col.kind)
+		}
+	}
+	return r, nil
+}
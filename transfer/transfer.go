@@ -0,0 +1,252 @@
+// Package transfer moves table rows to and from CSV, JSON Lines and Parquet files. Rows go
+// through the Cassandra JSON encoding, read with SELECT JSON and written with INSERT JSON,
+// so any table works from its definition alone, either read from a cluster or derived from
+// a registered DAO type.
+//
+//	info, _ := da.Registry().Lookup(&Tx{})
+//	iter := da.FullIterJSON(&Tx{})
+//	n, err := transfer.Export(iter, info.Schema(&Tx{}), transfer.CSV, w)
+package transfer
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/blockcypher/dago"
+)
+
+type Format string
+
+const (
+	CSV     Format = "csv"
+	JSONL   Format = "jsonl"
+	Parquet Format = "parquet"
+)
+
+// Format of a file according to its extension, empty when unknown.
+func FormatOf(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return CSV
+	case ".jsonl", ".ndjson", ".json":
+		return JSONL
+	case ".parquet":
+		return Parquet
+	}
+	return ""
+}
+
+// Row as a JSON object keyed by column names, values following the Cassandra JSON encoding.
+type row map[string]json.RawMessage
+
+type rowWriter interface {
+	Write(r row) error
+	Close() error
+}
+
+type rowReader interface {
+	// Returns io.EOF after the last row
+	Read() (row, error)
+}
+
+// Writes all rows of the iterator, going over JSON rows like the ones of
+// DataAccess.FullIterJSON, to w in the format. Returns the number of rows written.
+func Export(iter dago.Iter, table *dago.TableSchema, format Format, w io.Writer) (int, error) {
+	var rw rowWriter
+	switch format {
+	case CSV:
+		rw = newCSVWriter(w, table)
+	case JSONL:
+		rw = newJSONLWriter(w)
+	case Parquet:
+		rw = newParquetWriter(w, table)
+	default:
+		iter.Close()
+		return 0, errors.New("transfer: unknown format " + string(format))
+	}
+
+	n := 0
+	for doc, ok := dago.ScanJSON(iter); ok; doc, ok = dago.ScanJSON(iter) {
+		var r row
+		if err := json.Unmarshal(doc, &r); err != nil {
+			iter.Close()
+			return n, err
+		}
+		if err := rw.Write(r); err != nil {
+			iter.Close()
+			return n, err
+		}
+		n++
+	}
+	if err := iter.Close(); err != nil {
+		return n, err
+	}
+	return n, rw.Close()
+}
+
+type ImportOptions struct {
+	// Rows saved concurrently, 1 when not set
+	Concurrency int
+	// Rows read and saved before reporting progress, 1000 when not set
+	BatchSize int
+	// Rows to skip, the ones imported by an interrupted run to resume
+	Skip int
+	// Called after each batch with the total number of rows imported, skipped ones included,
+	// to record progress
+	Progress func(done int) error
+}
+
+// Reads rows from r in the format and saves them with the provided function, typically
+// CQLHelper.SaveJSON, one call per row. Rows are saved concurrently within batches of
+// BatchSize rows, so that progress is reported once all rows before it are saved. Parquet
+// files need r to be an io.ReaderAt and an io.Seeker, like files. Returns the total number
+// of rows imported.
+func Import(save func(doc []byte) error, table *dago.TableSchema, format Format, r io.Reader, opts ImportOptions) (int, error) {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = 1000
+	}
+	var rr rowReader
+	var err error
+	switch format {
+	case CSV:
+		rr, err = newCSVReader(r, table)
+	case JSONL:
+		rr = newJSONLReader(r)
+	case Parquet:
+		rr, err = newParquetReader(r, table)
+	default:
+		err = errors.New("transfer: unknown format " + string(format))
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	done := 0
+	for ; done < opts.Skip; done++ {
+		if _, err := rr.Read(); err == io.EOF {
+			return done, nil
+		} else if err != nil {
+			return done, err
+		}
+	}
+	batch := make([][]byte, 0, opts.BatchSize)
+	for {
+		r, err := rr.Read()
+		if err != nil && err != io.EOF {
+			return done, err
+		}
+		if err == nil {
+			doc, err := json.Marshal(r)
+			if err != nil {
+				return done, err
+			}
+			batch = append(batch, doc)
+		}
+		if len(batch) == opts.BatchSize || err == io.EOF && len(batch) > 0 {
+			if err := saveBatch(save, batch, opts.Concurrency); err != nil {
+				return done, err
+			}
+			done += len(batch)
+			batch = batch[:0]
+			if opts.Progress != nil {
+				if err := opts.Progress(done); err != nil {
+					return done, err
+				}
+			}
+		}
+		if err == io.EOF {
+			return done, nil
+		}
+	}
+}
+
+func saveBatch(save func(doc []byte) error, docs [][]byte, concurrency int) error {
+	errs := make([]error, len(docs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for n, doc := range docs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(n int, doc []byte) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[n] = save(doc)
+		}(n, doc)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// How values of a CQL type are encoded in JSON rows.
+type jsonKind int
+
+const (
+	jsonString jsonKind = iota
+	jsonInt
+	jsonFloat
+	jsonBool
+	// numbers kept as text to avoid losing precision, and collections and user defined types
+	jsonRaw
+)
+
+func jsonKindOf(cqlType string) jsonKind {
+	switch cqlType {
+	case "tinyint", "smallint", "int", "bigint", "counter":
+		return jsonInt
+	case "float", "double":
+		return jsonFloat
+	case "boolean":
+		return jsonBool
+	case "varint", "decimal":
+		return jsonRaw
+	case "ascii", "text", "varchar", "blob", "uuid", "timeuuid", "timestamp", "date", "time", "duration", "inet":
+		return jsonString
+	}
+	return jsonRaw
+}
+
+var jsonNull = json.RawMessage("null")
+
+// Key of a column in JSON rows, case sensitive names being quoted.
+func jsonKey(col string) string {
+	if col != strings.ToLower(col) {
+		return strconv.Quote(col)
+	}
+	return col
+}
+
+// Text of a JSON value, unquoted for strings and empty for null.
+func textOf(value json.RawMessage) string {
+	if len(value) == 0 || string(value) == "null" {
+		return ""
+	}
+	if value[0] == '"' {
+		var s string
+		if json.Unmarshal(value, &s) == nil {
+			return s
+		}
+	}
+	return string(value)
+}
+
+// JSON value of text written by textOf for a column of the kind.
+func valueOf(text string, kind jsonKind) json.RawMessage {
+	if text == "" {
+		return jsonNull
+	}
+	if kind == jsonString {
+		quoted, _ := json.Marshal(text)
+		return quoted
+	}
+	return json.RawMessage(text)
+}
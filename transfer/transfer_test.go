@@ -0,0 +1,89 @@
+package transfer
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/blockcypher/dago"
+	"github.com/stretchr/testify/assert"
+)
+
+var outputs = parseTable(`create table addr_outputs (
+	address text, bheight bigint, tx_hash blob, "Value" varint, ratio double, spent boolean,
+	spent_by map<text, frozen<list<int>>>, memo text,
+	primary key (address, bheight, tx_hash))`)
+
+func parseTable(cql string) *dago.TableSchema {
+	tables, err := dago.ParseCQLSchema(cql)
+	if err != nil {
+		panic(err)
+	}
+	return tables[0]
+}
+
+var rows = []string{
+	`{"address": "1A1z", "bheight": 500000, "tx_hash": "0x0a0b", "\"Value\"": 123456789012345678901234567890, "ratio": 0.25, "spent": true, "spent_by": {"a": [1, 2]}, "memo": "x, \"y\""}`,
+	`{"address": "1A1z", "bheight": 500001, "tx_hash": "0x0c", "\"Value\"": 1, "ratio": null, "spent": false, "spent_by": null, "memo": null}`,
+}
+
+// Iterator over JSON rows, like the ones of SELECT JSON
+type jsonIter struct {
+	rows []string
+}
+
+func (self *jsonIter) Scan(dest ...interface{}) bool {
+	if len(self.rows) == 0 {
+		return false
+	}
+	*dest[0].(*string), self.rows = self.rows[0], self.rows[1:]
+	return true
+}
+
+func (self *jsonIter) Close() error {
+	return nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []Format{CSV, JSONL, Parquet} {
+		buf := new(bytes.Buffer)
+		n, err := Export(&jsonIter{rows}, outputs, format, buf)
+		assert.NoError(t, err, format)
+		assert.Equal(t, 2, n)
+
+		var mutex sync.Mutex
+		saved := make([]string, 0)
+		save := func(doc []byte) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			saved = append(saved, string(doc))
+			return nil
+		}
+		progress := []int{}
+		n, err = Import(save, outputs, format, bytes.NewReader(buf.Bytes()),
+			ImportOptions{BatchSize: 1, Skip: 1, Progress: func(done int) error {
+				progress = append(progress, done)
+				return nil
+			}})
+		assert.NoError(t, err, format)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, []int{2}, progress)
+		if assert.Len(t, saved, 1, format) {
+			assert.JSONEq(t, rows[1], saved[0], format)
+		}
+	}
+}
+
+func TestCSV(t *testing.T) {
+	buf := new(bytes.Buffer)
+	_, err := Export(&jsonIter{rows[:1]}, outputs, CSV, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "address,bheight,tx_hash,Value,ratio,spent,spent_by,memo\n"+
+		`1A1z,500000,0x0a0b,123456789012345678901234567890,0.25,true,"{""a"": [1, 2]}","x, ""y"""`+"\n", buf.String())
+
+	var saved json.RawMessage
+	_, err = Import(func(doc []byte) error { saved = doc; return nil }, outputs, CSV, buf, ImportOptions{})
+	assert.NoError(t, err)
+	assert.JSONEq(t, rows[0], string(saved))
+}
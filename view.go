@@ -0,0 +1,152 @@
+package dago
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// DAOs bound to a materialized view implement this interface, TableName returning the name of
+// the view and their key qualifiers declaring the key layout of the view rather than the one
+// of its base table. They're read like any other DAO, with Get, PartitionIter and the like,
+// but all writes are refused as Cassandra maintains views from their base table.
+// Example:
+//
+//	type TxByBlock struct {
+//		BlockHash string `column:"block_hash,key"`
+//		Index     int32  `column:"idx,sort"`
+//		Hash      string `column:"hash,sort"`
+//		Fees      int64  `column:"fees"`
+//	}
+//
+//	func (self *TxByBlock) TableName() string { return "txs_by_block" }
+//	func (self *TxByBlock) BaseTable() string { return "txs" }
+type DAOView interface {
+	BaseTable() string
+}
+
+// Checks the DAO bound to a view can be, views having neither indexes nor secondary tables.
+func viewOf(info *DAOInfo, dao interface{}) error {
+	view, ok := dao.(DAOView)
+	if !ok {
+		return nil
+	}
+	info.BaseTable = view.BaseTable()
+	if info.BaseTable == "" {
+		return &DefinitionError{info.Type, "", "views need a base table"}
+	}
+	if len(info.Secondary) > 0 {
+		return &DefinitionError{info.Type, "", "views can't have secondary tables"}
+	}
+	for _, col := range info.Columns {
+		if col.Index != "" {
+			return &DefinitionError{info.Type, col.Field, "views can't be indexed"}
+		}
+	}
+	return nil
+}
+
+// Same as check, also refusing DAOs bound to views.
+func (self *DataAccess) checkWrite(dao DAOLite) error {
+	if err := self.check(dao); err != nil {
+		return err
+	}
+	if info, _ := self.registry.Lookup(dao); info.BaseTable != "" {
+		return errors.New("dago: can't write to materialized view " + self.tableOf(dao) + ", write to " +
+			info.BaseTable + " instead")
+	}
+	return nil
+}
+
+// CREATE MATERIALIZED VIEW statement of a view, see CQL.
+func (self *TableSchema) viewCQL(name string) string {
+	base := QuoteIdent(self.Base)
+	if self.Keyspace != "" {
+		base = QuoteIdent(self.Keyspace) + "." + base
+	}
+	cols := make([]string, len(self.Columns))
+	for n, col := range self.Columns {
+		cols[n] = QuoteIdent(col.Name)
+	}
+	keys := append(self.PartitionKeys(), self.ClusteringKeys()...)
+	notNull := make([]string, len(keys))
+	for n, col := range keys {
+		notNull[n] = QuoteIdent(col.Name) + " IS NOT NULL"
+	}
+	return "CREATE MATERIALIZED VIEW " + name + " AS\n" +
+		"    SELECT " + strings.Join(cols, ", ") + " FROM " + base + "\n" +
+		"    WHERE " + strings.Join(notNull, " AND ") + "\n" +
+		"    " + self.primaryKeyCQL() + ";\n"
+}
+
+// Parses a CREATE MATERIALIZED VIEW statement, the types of its columns being the ones of the
+// base table which must have been parsed before.
+func parseCreateView(stmt string, tables []*TableSchema) (*TableSchema, error) {
+	lower := blankLower(stmt)
+	as, from, where := strings.Index(lower, " as "), strings.Index(lower, " from "), strings.Index(lower, " where ")
+	key := strings.Index(lower, "primary key")
+	if as < 0 || from < as || key < from {
+		return nil, errors.New("dago: bad view definition " + stmt)
+	}
+	if where < 0 || where > key {
+		where = key
+	}
+	view := &TableSchema{}
+	header := strings.Fields(stmt[:as])
+	view.Keyspace, view.Name = splitTableName(header[len(header)-1])
+	keyspace, base := splitTableName(strings.TrimSpace(stmt[from+len(" from ") : where]))
+	view.Base = base
+
+	var baseTable *TableSchema
+	for _, table := range tables {
+		if table.Name == base && (keyspace == "" || table.Keyspace == keyspace) && table.Base == "" {
+			baseTable = table
+		}
+	}
+	if baseTable == nil {
+		return nil, errors.New("dago: view " + view.Name + " of unknown table " + base)
+	}
+
+	selected := strings.TrimSpace(stmt[strings.Index(lower, "select")+len("select") : from])
+	if selected == "*" {
+		for _, col := range baseTable.Columns {
+			view.Columns = append(view.Columns, &ColumnSchema{col.Name, col.Type, NON_KEY})
+		}
+	} else {
+		for _, name := range splitTopLevel(selected, ',') {
+			col := baseTable.Column(unquoteIdent(strings.TrimSpace(name)))
+			if col == nil {
+				return nil, errors.New("dago: unknown column " + name + " in view " + view.Name)
+			}
+			view.Columns = append(view.Columns, &ColumnSchema{col.Name, col.Type, NON_KEY})
+		}
+	}
+	spec := stmt[key+len("primary key"):]
+	if close := matchingParen(spec, strings.Index(spec, "(")); close >= 0 {
+		spec = spec[:close+1]
+	}
+	partition, clustering := parsePrimaryKey(spec)
+	if err := view.setKeys(partition, clustering); err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+// Lower cased statement with white spaces turned into plain spaces, indexes matching the ones
+// of the statement.
+func blankLower(stmt string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		return unicode.ToLower(r)
+	}, stmt)
+}
+
+// Splits a possibly qualified table name into its unquoted keyspace and name.
+func splitTableName(name string) (string, string) {
+	if dot := strings.Index(name, "."); dot >= 0 {
+		return unquoteIdent(name[:dot]), unquoteIdent(name[dot+1:])
+	}
+	return "", unquoteIdent(name)
+}
@@ -0,0 +1,85 @@
+package dago
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TxByBlock struct {
+	BlockHash string `column:"block_hash,key"`
+	Index     int32  `column:"idx,sort"`
+	Hash      string `column:"hash,sort"`
+	Fees      int64  `column:"fees"`
+}
+
+func (self *TxByBlock) TableName() string {
+	return "txs_by_block"
+}
+
+func (self *TxByBlock) BaseTable() string {
+	return "txs"
+}
+
+type IndexedView struct {
+	Hash string `column:"hash,key"`
+	Fees int64  `column:"fees,index"`
+}
+
+func (self *IndexedView) TableName() string {
+	return "txs_by_hash"
+}
+
+func (self *IndexedView) BaseTable() string {
+	return "txs"
+}
+
+const viewSchema = `
+CREATE TABLE bitcoin.txs (hash text PRIMARY KEY, block_hash text, idx int, fees bigint);
+`
+
+func TestViewSchema(t *testing.T) {
+	info, err := NewRegistry().Register(&TxByBlock{}, WithKeyspace("bitcoin"))
+	assert.NoError(t, err)
+	assert.Equal(t, "txs", info.BaseTable)
+	cql := info.Schema(&TxByBlock{}).CQL()
+	assert.Equal(t, `CREATE MATERIALIZED VIEW bitcoin.txs_by_block AS
+    SELECT block_hash, idx, hash, fees FROM bitcoin.txs
+    WHERE block_hash IS NOT NULL AND idx IS NOT NULL AND hash IS NOT NULL
+    PRIMARY KEY ((block_hash), idx, hash);
+`, cql)
+
+	tables, err := ParseCQLSchema(viewSchema + cql)
+	assert.NoError(t, err)
+	if assert.Len(t, tables, 2) {
+		view := tables[1]
+		assert.Equal(t, "txs", view.Base)
+		assert.Equal(t, []*ColumnSchema{
+			{"block_hash", "text", PARTITION_KEY},
+			{"idx", "int", CLUSTERING_KEY},
+			{"hash", "text", CLUSTERING_KEY},
+			{"fees", "bigint", NON_KEY},
+		}, view.Columns)
+		assert.NoError(t, info.Check(view))
+	}
+
+	_, err = ParseCQLSchema(cql)
+	assert.EqualError(t, err, "dago: view txs_by_block of unknown table txs")
+
+	_, err = NewRegistry().Register(&IndexedView{})
+	assert.EqualError(t, err, "dago: invalid DAO *dago.IndexedView: field Fees: views can't be indexed")
+}
+
+func TestViewWritesRefused(t *testing.T) {
+	da := NewDataAccess(NewCQLHelper(nil)).In("bitcoin")
+	tx := &TxByBlock{"00ab", 1, "cd", 10}
+	msg := "dago: can't write to materialized view bitcoin.txs_by_block, write to txs instead"
+	assert.EqualError(t, da.Save(tx), msg)
+	assert.EqualError(t, da.SavePartial(tx, "Fees"), msg)
+	assert.EqualError(t, da.SaveIfNotExists(tx), msg)
+	assert.EqualError(t, da.Delete(tx), msg)
+	assert.EqualError(t, da.DeletePartition(tx), msg)
+	assert.EqualError(t, da.DeleteFields(tx, "Fees"), msg)
+	assert.EqualError(t, da.SaveJSON(tx, json.RawMessage(`{"block_hash": "00ab", "idx": 1, "hash": "cd"}`)), msg)
+}
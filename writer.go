@@ -0,0 +1,162 @@
+package dago
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrWriterClosed = errors.New("dago: async writer is closed")
+
+// All errors encountered by an AsyncWriter since its last Flush.
+type WriteErrors []error
+
+func (self WriteErrors) Error() string {
+	msgs := make([]string, len(self))
+	for n, err := range self {
+		msgs[n] = err.Error()
+	}
+	return strconv.Itoa(len(self)) + " write(s) failed: " + strings.Join(msgs, "; ")
+}
+
+// Saves DAOs in the background, keeping a bounded number of writes in flight. DAOs can be
+// handed over either with Submit or by sending them on the Input channel, both blocking when
+// all in flight slots are taken. Flush waits for all pending writes to be confirmed.
+// Example:
+//
+//	w := da.NewAsyncWriter(64)
+//	for _, out := range outputs {
+//		w.Submit(out)
+//	}
+//	if err := w.Flush(); err != nil {...}
+//	// safe to checkpoint the block height now
+type AsyncWriter struct {
+	da    *DataAccess
+	input chan DAOLite
+	sync  chan struct{}
+	slots chan struct{}
+	done  chan struct{}
+
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	pending int
+	errs    WriteErrors
+	closed  bool
+}
+
+// Creates an AsyncWriter saving at most inFlight DAOs concurrently. Close it when done.
+func (self *DataAccess) NewAsyncWriter(inFlight int) *AsyncWriter {
+	if inFlight < 1 {
+		inFlight = 1
+	}
+	w := &AsyncWriter{
+		da:    self,
+		input: make(chan DAOLite),
+		sync:  make(chan struct{}),
+		slots: make(chan struct{}, inFlight),
+		done:  make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mutex)
+	go w.consume()
+	return w
+}
+
+// Channel to send DAOs to save on, as an alternative to Submit. It's closed by Close, so
+// sending on it afterwards panics: callers sending on it must be done before closing the
+// writer, or use Submit which returns ErrWriterClosed instead.
+func (self *AsyncWriter) Input() chan<- DAOLite {
+	return self.input
+}
+
+// Schedules the save of the provided DAO, blocking until a write slot is available.
+func (self *AsyncWriter) Submit(dao DAOLite) error {
+	// counted as pending before Close can return, so that it waits for the write
+	self.mutex.Lock()
+	if self.closed {
+		self.mutex.Unlock()
+		return ErrWriterClosed
+	}
+	self.pending++
+	self.mutex.Unlock()
+	self.start(dao)
+	return nil
+}
+
+func (self *AsyncWriter) submit(dao DAOLite) {
+	self.mutex.Lock()
+	self.pending++
+	self.mutex.Unlock()
+	self.start(dao)
+}
+
+// Saves the DAO once a write slot is available, it must already be counted as pending.
+func (self *AsyncWriter) start(dao DAOLite) {
+	self.slots <- struct{}{}
+	go func() {
+		err := self.da.Save(dao)
+		<-self.slots
+
+		self.mutex.Lock()
+		if err != nil {
+			self.errs = append(self.errs, err)
+		}
+		self.pending--
+		if self.pending == 0 {
+			self.cond.Broadcast()
+		}
+		self.mutex.Unlock()
+	}()
+}
+
+func (self *AsyncWriter) consume() {
+	defer close(self.done)
+	for {
+		select {
+		case dao, ok := <-self.input:
+			if !ok {
+				return
+			}
+			self.submit(dao)
+		case <-self.sync:
+			// a flush is waiting for all DAOs received so far to be submitted
+		}
+	}
+}
+
+// Waits until all DAOs submitted so far, including those sent on the Input channel, are
+// saved. Returns the errors of all writes that failed since the previous Flush as
+// WriteErrors, or nil.
+func (self *AsyncWriter) Flush() error {
+	// the input channel is unbuffered so once the consumer is ready again, anything sent
+	// before has been submitted
+	select {
+	case self.sync <- struct{}{}:
+	case <-self.done:
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for self.pending > 0 {
+		self.cond.Wait()
+	}
+	errs := self.errs
+	self.errs = nil
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Stops accepting DAOs and flushes all pending writes.
+func (self *AsyncWriter) Close() error {
+	self.mutex.Lock()
+	closed := self.closed
+	self.closed = true
+	self.mutex.Unlock()
+	if !closed {
+		close(self.input)
+		<-self.done
+	}
+	return self.Flush()
+}
@@ -0,0 +1,106 @@
+package dago
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsyncWriterFlush(t *testing.T) {
+	rec, da := newRecorder(nil)
+	w := da.NewAsyncWriter(4)
+	for n := 0; n < 10; n++ {
+		assert.NoError(t, w.Submit(&SimpleDao{AString: "foo", AnInt: int64(n)}))
+	}
+	w.Input() <- &SimpleDao{AString: "bar"}
+	assert.NoError(t, w.Flush())
+	assert.Len(t, rec.CQL(), 11)
+	assert.NoError(t, w.Close())
+}
+
+func TestAsyncWriterBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	var mutex sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	_, da := newRecorder(func(st *Statement) ([][]interface{}, error) {
+		mutex.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mutex.Unlock()
+		<-release
+		mutex.Lock()
+		inFlight--
+		mutex.Unlock()
+		return nil, nil
+	})
+	w := da.NewAsyncWriter(2)
+	assert.NoError(t, w.Submit(&SimpleDao{AString: "a"}))
+	assert.NoError(t, w.Submit(&SimpleDao{AString: "b"}))
+
+	submitted := make(chan struct{})
+	go func() {
+		w.Submit(&SimpleDao{AString: "c"})
+		close(submitted)
+	}()
+	select {
+	case <-submitted:
+		t.Fatal("submitted beyond the bound")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-submitted
+	assert.NoError(t, w.Close())
+	assert.Equal(t, 2, maxInFlight)
+}
+
+func TestAsyncWriterErrors(t *testing.T) {
+	failure := errors.New("write failed")
+	_, da := newRecorder(func(st *Statement) ([][]interface{}, error) {
+		if st.Values[0] == "bad" {
+			return nil, failure
+		}
+		return nil, nil
+	})
+	w := da.NewAsyncWriter(2)
+	w.Submit(&SimpleDao{AString: "bad"})
+	w.Submit(&SimpleDao{AString: "good"})
+	w.Submit(&SimpleDao{AString: "bad"})
+	err := w.Flush()
+	var errs WriteErrors
+	if assert.ErrorAs(t, err, &errs) {
+		assert.Len(t, errs, 2)
+		assert.ErrorIs(t, errs[0], failure)
+	}
+	assert.EqualError(t, err, "2 write(s) failed: write failed; write failed")
+	// errors are reported once
+	assert.NoError(t, w.Flush())
+}
+
+func TestAsyncWriterClose(t *testing.T) {
+	release := make(chan struct{})
+	rec, da := newRecorder(func(st *Statement) ([][]interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	w := da.NewAsyncWriter(1)
+	assert.NoError(t, w.Submit(&SimpleDao{AString: "a"}))
+	closed := make(chan error)
+	go func() {
+		closed <- w.Close()
+	}()
+	select {
+	case <-closed:
+		t.Fatal("closed with a pending write")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	assert.NoError(t, <-closed)
+	assert.Len(t, rec.CQL(), 1)
+	assert.Equal(t, ErrWriterClosed, w.Submit(&SimpleDao{AString: "b"}))
+	assert.NoError(t, w.Close())
+}